@@ -1,23 +1,108 @@
 package cmd
 
 import (
+	"fmt"
+	"log"
+	"time"
+
 	"github.com/spf13/cobra"
 	
 	"github.com/fuxxcss/redi2fuzz/pkg/fuzz"
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+var (
+	diffTargets string
+	fuzzOpts    fuzz.Options
+	fuzzSeed    uint64
+	regenPath   string
 )
 
+// single target options, diff would ignore them
+var diffDeny = []string{
+	"jobs", "raw", "confusion", "profile", "persist", "repl", "config-set", "metrics-addr", "regen",
+}
+
 // fuzzCmd 
 var fuzzCmd = &cobra.Command {
 	Use:   "fuzz",
 	Short: "Ready to Fuzz.",
 	Run: func(cmd *cobra.Command, args []string) {
 
-		fuzz.Fuzz(fuzzTarget)
+		// sequence seeds, replay a run with the same seed
+		if !cmd.Flags().Changed("seed") {
+			fuzzSeed = uint64(time.Now().UnixNano())
+		}
+
+		utils.SetSeed(fuzzSeed)
+		fmt.Printf("[*] seed %d\n", fuzzSeed)
+
+		// differential
+		if diffTargets != "" {
+
+			for _, name := range diffDeny {
+
+				if cmd.Flags().Changed(name) {
+					log.Fatalf("--%s is not supported with --diff", name)
+				}
+			}
+
+			targets, err := utils.ParseTargets(diffTargets)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fuzz.Diff(targets)
+			return
+		}
+
+		if fuzzOpts.Jobs < 1 {
+			log.Fatal("jobs must be at least 1")
+		}
+
+		err := fuzz.ParsePersist(fuzzOpts.Persist)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if fuzzOpts.Confusion < 0 || fuzzOpts.Confusion > 100 {
+			log.Fatal("confusion must be 0-100")
+		}
+
+		_, err = utils.ParseProfiles(utils.Targets[fuzzTarget], fuzzOpts.Profile)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// one sequence from the header of a crash file
+		if regenPath != "" {
+			fuzz.Regen(fuzzTarget, fuzzOpts, regenPath)
+			return
+		}
+
+		fuzz.Fuzz(fuzzTarget, fuzzOpts)
 	},
 }
 
 func init() {
 
+	fuzzCmd.Flags().IntVarP(&fuzzOpts.Jobs, "jobs", "j", 1, "Parallel Workers, one target instance each")
+	fuzzCmd.Flags().BoolVar(&fuzzOpts.Raw, "raw", false, "Raw RESP Executor, mutate protocol framing")
+	fuzzCmd.Flags().IntVar(&fuzzOpts.Confusion, "confusion", model.CORPUS_CONFUSION, "Type Confusion Percent, bind keys of another type")
+	fuzzCmd.Flags().BoolVarP(&fuzzOpts.Quiet, "quiet", "q", false, "No Status Screen, e.g. CI logs")
+	fuzzCmd.Flags().StringVar(&fuzzOpts.MetricsAddr, "metrics-addr", "", "Prometheus Listener, e.g. :9100")
+	fuzzCmd.Flags().StringVar(&fuzzOpts.Persist, "persist", "", "Persistence Oracle after each sequence (rdb, aof, both)")
+	fuzzCmd.Flags().BoolVar(&fuzzOpts.Repl, "repl", false, "Master/Replica Pair, compare digests after each sequence")
+	fuzzCmd.Flags().BoolVar(&fuzzOpts.ConfigSet, "config-set", false, "Runtime CONFIG SET from CONFIG GET * before sequences")
+	fuzzCmd.Flags().StringVar(&fuzzOpts.Profile, "profile", "", "Startup Profile (aof, io-threads, maxmemory, ..., round-robin)")
+	fuzzCmd.Flags().Uint64Var(&fuzzSeed, "seed", 0, "Seed of Sequence Seeds, default from time")
+	fuzzCmd.Flags().StringVar(&regenPath, "regen", "", "Print the Sequence of a Crash File Header from the saved corpus, then exit")
+	fuzzCmd.Flags().StringVar(&diffTargets, "diff", "", "Differential Targets (redis,keydb,...)")
+
 	rootCmd.AddCommand(fuzzCmd)
 	
 }
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+
+	"github.com/fuxxcss/redi2fuzz/pkg/analyze"
+
+	"github.com/spf13/cobra"
+)
+
+// minimizeCmd shrink crash file
+var minimizeCmd = &cobra.Command{
+	Use:   "minimize",
+	Short: "Minimize Crash File.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+		analyze.Minimize(fuzzTarget, path)
+	},
+}
+
+func init() {
+
+	rootCmd.AddCommand(minimizeCmd)
+	
+}
@@ -9,6 +9,8 @@ import (
 
 var (
 	fuzzTarget utils.TargetType
+	targetName string
+	configPath string
 )
 
 // rootCmd : default without args
@@ -16,30 +18,46 @@ var rootCmd = &cobra.Command{
 	Use:   "redi2fuzz",
 	Short: "A fuzzing tool for redis.",
 	Long:  `A fuzzing tool for redis-based dbms with graph mutation mode.`,
+	// flags are parsed here
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+
+		// targets from file, before names are parsed
+		if configPath != "" {
+
+			err := utils.LoadConfig(configPath)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		target, err := utils.ParseTarget(targetName)
+
+		if err != nil {
+			return err
+		}
+
+		fuzzTarget = target
+
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 
-	var arg string
-	rootCmd.PersistentFlags().StringVarP(&arg, "target", "t", "redis", "Fuzz Target (redis, keydb, redis-stack)")
-
-	switch arg {
-	case "redis", "Redis" :
-		fuzzTarget = utils.REDI_REDIS
-	case "keydb", "KeyDB" :
-		fuzzTarget = utils.REDI_KEYDB
-	case "redis-stack", "Redis Stack", "Redis-Stack":
-		fuzzTarget = utils.REDI_STACK
-	default:
-		log.Fatalf("err: %s is not support\n", fuzzTarget)
-	}
-
 	err := rootCmd.Execute()
 	
 	if err != nil {
 		log.Fatal(err)
 	}
 	
-}
\ No newline at end of file
+}
+
+func init() {
+
+	rootCmd.PersistentFlags().StringVarP(&targetName, "target", "t", "redis", "Fuzz Target (redis, keydb, valkey, redis-stack, redis-cluster, etcd)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Target Definitions, json (see README)")
+
+}
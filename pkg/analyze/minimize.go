@@ -0,0 +1,220 @@
+package analyze
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Minimize Definition
+ */
+
+// minimized file
+const (
+	MinimizeSuffix string = ".min"
+	// shorten str longer than
+	MINIMIZE_STRLEN int = 16
+)
+
+type minimizer struct {
+	target db.DB
+	// seed, profile and owner, replayed first
+	header utils.CrashJson
+	// crash signature
+	key   string
+	tries int
+}
+
+/*
+ * Minimize Functions
+ */
+
+// public
+func Minimize(target utils.TargetType, path string) {
+
+	cj, err := LoadCrash(path)
+
+	if err != nil {
+		log.Fatalln("err: bug file failed.", err)
+	}
+
+	feature := crashFeature(target, cj)
+
+	// interface
+	DBtarget := db.NewDB(target, feature)
+
+	if DBtarget == nil {
+		log.Fatalln("err: target is not support.")
+	}
+
+	// StartUp target first
+	err = DBtarget.StartUp()
+	defer DBtarget.ShutDown()
+
+	if err != nil {
+		log.Println("err: db startup failed.")
+		return
+	}
+
+	m := &minimizer{target: DBtarget}
+
+	// original crash
+	index := Replay(DBtarget, cj)
+
+	if index < 0 {
+		fmt.Println("not a bug")
+		return
+	}
+
+	m.key = Signature(DBtarget.Stderr())
+	fmt.Printf("[*] crash at line %d: %s\n", index+1, m.key)
+
+	// lines after crash are useless
+	cj = cj[:index+1]
+
+	// seed, profile and owner header stays first
+	m.header = make(utils.CrashJson, 0, 1)
+
+	if _, ok := utils.CrashHeader(cj); ok {
+		m.header = append(m.header, cj[0])
+		cj = cj[1:]
+	}
+
+	cj = m.minimizeLines(cj)
+	cj = m.minimizeTokens(cj)
+	cj = m.minimizeStrs(cj)
+
+	cj = append(m.header, cj...)
+
+	// write minimized
+	bytes, err := cj.ToJson()
+
+	if err != nil {
+		log.Fatalln("err: json encode failed.")
+	}
+
+	name := path + MinimizeSuffix
+	err = os.WriteFile(name, bytes, 0664)
+
+	if err != nil {
+		log.Fatalln("err: write minimized failed.", err)
+	}
+
+	fmt.Printf("[*] %d lines after %d tries, saved to %s\n", len(cj), m.tries, name)
+}
+
+// private
+// does cj still trigger the same crash
+func (self *minimizer) check(cj utils.CrashJson) bool {
+
+	self.tries++
+
+	// fresh target, CONFIG SET of earlier tries is gone
+	err := self.target.Restart()
+
+	if err != nil {
+		log.Println("err: db restart failed.", err)
+		return false
+	}
+
+	// rdb of earlier tries may be loaded
+	self.target.CleanUp()
+
+	// CleanUp moved the cluster owner, header sets it back
+	index := Replay(self.target, append(cloneCrash(self.header), cj...))
+
+	if index < 0 {
+		return false
+	}
+
+	return Signature(self.target.Stderr()) == self.key
+}
+
+// private
+// remove chunks of lines, halve chunk size until one line
+func (self *minimizer) minimizeLines(cj utils.CrashJson) utils.CrashJson {
+
+	for chunk := len(cj) / 2; chunk >= 1; chunk /= 2 {
+
+		for i := 0; i < len(cj); {
+
+			end := min(i+chunk, len(cj))
+
+			candidate := cloneCrash(cj[:i])
+			candidate = append(candidate, cloneCrash(cj[end:])...)
+
+			if len(candidate) > 0 && self.check(candidate) {
+				cj = candidate
+				continue
+			}
+
+			i += chunk
+		}
+	}
+
+	return cj
+}
+
+// private
+// remove args one by one, keep cmd and line options
+func (self *minimizer) minimizeTokens(cj utils.CrashJson) utils.CrashJson {
+
+	for i := range cj {
+
+		_, tokens := utils.DecodeLine(cj[i])
+		head := len(cj[i]) - len(tokens)
+
+		for j := len(cj[i]) - 1; j >= head+1; j-- {
+
+			candidate := cloneCrash(cj)
+			candidate[i] = append(candidate[i][:j], candidate[i][j+1:]...)
+
+			if self.check(candidate) {
+				cj = candidate
+			}
+		}
+	}
+
+	return cj
+}
+
+// private
+// halve long str args, e.g. InterestLong
+func (self *minimizer) minimizeStrs(cj utils.CrashJson) utils.CrashJson {
+
+	for i := range cj {
+
+		for j := range cj[i] {
+
+			for len(cj[i][j]) > MINIMIZE_STRLEN {
+
+				candidate := cloneCrash(cj)
+				candidate[i][j] = cj[i][j][:len(cj[i][j])/2]
+
+				if !self.check(candidate) {
+					break
+				}
+
+				cj = candidate
+			}
+		}
+	}
+
+	return cj
+}
+
+// private
+func cloneCrash(cj utils.CrashJson) utils.CrashJson {
+
+	ret := make(utils.CrashJson, len(cj))
+
+	for i, line := range cj {
+		ret[i] = append([]string{}, line...)
+	}
+
+	return ret
+}
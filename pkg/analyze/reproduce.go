@@ -3,7 +3,9 @@ package analyze
 import (
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"strings"
 
 	"github.com/fuxxcss/redi2fuzz/pkg/db"
 	"github.com/fuxxcss/redi2fuzz/pkg/utils"
@@ -11,21 +13,21 @@ import (
 
 func Analyze(target utils.TargetType, path string) {
 
-	// Analyze Target (redis, keydb, redis-stack)
-	feature := utils.Targets[target]
-	context, err := os.ReadFile(path)
+	// from json
+	cj, err := LoadCrash(path)
 
 	if err != nil {
-		log.Fatalln("err: bug file failed.")
+		log.Fatalln("err: bug file failed.", err)
 	}
 
+	// Analyze Target (redis, keydb, valkey, redis-stack)
+	feature := crashFeature(target, cj)
+
 	// interface
-	var DBtarget db.DB
+	DBtarget := db.NewDB(target, feature)
 
-	switch target {
-	// Redi
-	case utils.REDI_REDIS, utils.REDI_KEYDB, utils.REDI_STACK:
-		DBtarget = db.NewRedi(feature)
+	if DBtarget == nil {
+		log.Fatalln("err: target is not support.")
 	}
 
 	// StartUp target first
@@ -37,43 +39,121 @@ func Analyze(target utils.TargetType, path string) {
 		return
 	}
 
-	// from json
+	// test bug
+	index := Replay(DBtarget, cj)
+
+	// trigger bug
+	if index >= 0 {
+
+		fmt.Printf("line %d trigger bug\n", index+1)
+		fmt.Println(cj[index])
+		fmt.Println(DBtarget.Stderr())
+
+	} else {
+		fmt.Println("not a bug")
+	}
+
+}
+
+// private
+// startup args of the crash profile, header line is skipped by Replay
+func crashFeature(target utils.TargetType, cj utils.CrashJson) utils.TargetFeature {
+
+	feature := maps.Clone(utils.Targets[target])
+	name := utils.CrashProfile(cj)
+
+	if name == "" {
+		return feature
+	}
+
+	profiles, err := utils.ParseProfiles(feature, name)
+
+	if err != nil {
+		log.Println("err: crash profile invalid.", err)
+		return feature
+	}
+
+	fmt.Printf("[*] profile %s\n", name)
+	feature[utils.TARGET_PROFILE] = strings.Join(profiles[0].Args, " ")
+
+	return feature
+}
+
+// public
+func LoadCrash(path string) (utils.CrashJson, error) {
+
+	context, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
 	cj := make(utils.CrashJson, 0)
 	err = cj.FromJson(context)
 
 	if err != nil {
-		log.Fatalln("err: json decode failed.")
+		return nil, err
 	}
 
-	// test bug
-	index := -1
-	var bug []string
+	return cj, nil
+}
 
-	for i, line := range cj {
+// public
+// execute each line or pipeline, return the index of crash or hang line or -1
+func Replay(target db.DB, cj utils.CrashJson) int {
+
+	for i := 0; i < len(cj); {
+
+		// pipeline [i, end)
+		end := utils.LineGroup(cj, i)
+		last := end - 1
+
+		opts, line := utils.DecodeLine(cj[i])
+
+		// header, skip empty
+		if len(line) == 0 {
+			replayHeader(target, opts)
+			i = end
+			continue
+		}
 
 		// execute each line
-		DBtarget.Execute(line)
+		packets, isRaw := utils.DecodeRawLine(line)
+		raw, hasRaw := target.(db.RawExecutor)
+
+		var state utils.TargetState
 
-		alive := DBtarget.CheckAlive()
+		if isRaw && hasRaw {
+			state, _ = raw.ExecuteRaw(packets)
+		} else {
+			state, _ = db.ExecuteGroup(target, cj[i:end])
+		}
+
+		// hang
+		if state == utils.STATE_HANG {
+			return last
+		}
+
+		alive := target.CheckAlive()
 
 		// crash
 		if !alive {
-
-			index = i
-			bug = line
-			break
+			return last
 		}
+
+		i = end
 	}
 
-	// trigger bug
-	if index >= 0 {
+	return -1
+}
 
-		fmt.Printf("line %d trigger bug\n", index+1)
-		fmt.Println(bug)
-		fmt.Println(DBtarget.Stderr())
+// private
+// options of the running sequence, e.g. cluster owner
+func replayHeader(target db.DB, opts utils.LineOpts) {
 
-	} else {
-		fmt.Println("not a bug")
-	}
+	sharder, ok := target.(db.Sharder)
 
+	if ok {
+		sharder.SetOwner(opts.Owner)
+	}
 }
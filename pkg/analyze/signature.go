@@ -0,0 +1,219 @@
+package analyze
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+/*
+ * Signature Definition
+ */
+
+// top n frames
+const (
+	SIGNATURE_FRAMES int    = 5
+	SIGNATURE_LEN    int    = 16
+	SignatureUnknown string = "unknown"
+)
+
+// asan frame, #0 0x55d4 in func file:line
+var asanFrame = regexp.MustCompile(`^\s*#\d+\s+0x[0-9a-fA-F]+\s+in\s+(\S+)\s*(\S*)`)
+
+// redis bug report frame, redis-server *:6379(func+0x2d)[0x55d4]
+var rediFrame = regexp.MustCompile(`\(([A-Za-z_][\w.]*)\+0x[0-9a-fA-F]+\)\s*\[0x[0-9a-fA-F]+\]`)
+
+// frames out of project
+var skipFuncs = []string{
+	"__asan", "__interceptor", "__sanitizer", "__lsan", "__ubsan",
+	"__libc", "__GI_", "__pthread", "__restore_rt",
+	"_start", "start_thread", "clone", "raise", "abort",
+	"logStackTrace", "sigsegvHandler", "printCrashReport", "watchdogSignalHandler",
+	"_serverAssert", "_serverAssertPrintClientInfo", "_serverAssertPrintObject", "_serverPanic", "bugReportEnd",
+}
+
+var skipFiles = []string{
+	"libc.so", "libasan", "libpthread", "ld-linux", "compiler-rt", "sanitizer_common",
+}
+
+/*
+ * Signature Functions
+ */
+
+// public
+// hash of top in-project frames
+func Signature(stderr string) string {
+
+	frames := StackFrames(stderr)
+
+	if len(frames) > SIGNATURE_FRAMES {
+		frames = frames[:SIGNATURE_FRAMES]
+	}
+
+	data := strings.Join(frames, "\n")
+
+	// no stack, fall back to crash key
+	if len(frames) == 0 {
+		data = CrashKey(stderr)
+	}
+
+	if data == "" {
+		return SignatureUnknown
+	}
+
+	sum := sha1.Sum([]byte(data))
+
+	return hex.EncodeToString(sum[:])[:SIGNATURE_LEN]
+}
+
+// public
+// crash identity from sanitizer or redis bug report
+func CrashKey(stderr string) string {
+
+	for _, line := range strings.Split(stderr, "\n") {
+
+		line = strings.TrimSpace(line)
+
+		switch {
+
+		// asan, ==pid==ERROR: AddressSanitizer: ...
+		case strings.Contains(line, "ERROR: AddressSanitizer:"):
+			return line[strings.Index(line, "ERROR:"):]
+
+		// assert, pid:M date # ==> file:line 'expr' is not true
+		case strings.Contains(line, "==> "):
+			return line[strings.Index(line, "==> "):]
+
+		// signal, Redis x.y.z crashed by signal: 11
+		case strings.Contains(line, "crashed by signal"):
+			return line[strings.Index(line, "crashed by signal"):]
+		}
+	}
+
+	return ""
+}
+
+// public
+// in-project function names of the crash stack
+func StackFrames(stderr string) []string {
+
+	frames := asanFrames(stderr)
+
+	if len(frames) == 0 {
+		frames = rediFrames(stderr)
+	}
+
+	return frames
+}
+
+// private
+func asanFrames(stderr string) []string {
+
+	frames := make([]string, 0)
+	started := false
+
+	for _, line := range strings.Split(stderr, "\n") {
+
+		match := asanFrame.FindStringSubmatch(line)
+
+		// first stack only
+		if match == nil {
+			if started {
+				break
+			}
+			continue
+		}
+
+		started = true
+
+		if skipFrame(match[1], match[2]) {
+			continue
+		}
+
+		frames = append(frames, match[1])
+	}
+
+	return frames
+}
+
+// private
+// first stack after EIP, main thread on redis 7.2
+func rediFrames(stderr string) []string {
+
+	frames := make([]string, 0)
+	started := false
+	// EIP frame is repeated by the stack
+	eip := false
+	// frames of the first stack seen
+	stack := false
+
+	for _, line := range strings.Split(stderr, "\n") {
+
+		// ------ STACK TRACE ------
+		if strings.Contains(line, "STACK TRACE") {
+			started = true
+			continue
+		}
+
+		if !started {
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+
+		// next section
+		if strings.HasPrefix(line, "------") {
+			break
+		}
+
+		switch {
+
+		case line == "EIP:":
+			eip = true
+			continue
+
+		// end of EIP or of the first stack, e.g. bio threads follow
+		case line == "":
+			if stack {
+				return frames
+			}
+			eip = false
+			continue
+		}
+
+		match := rediFrame.FindStringSubmatch(line)
+
+		if eip || match == nil {
+			continue
+		}
+
+		stack = true
+
+		if skipFrame(match[1], line) {
+			continue
+		}
+
+		frames = append(frames, match[1])
+	}
+
+	return frames
+}
+
+// private
+func skipFrame(function, file string) bool {
+
+	for _, prefix := range skipFuncs {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+
+	for _, lib := range skipFiles {
+		if strings.Contains(file, lib) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,214 @@
+package analyze
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+const asanReport = `=================================================================
+==4242==ERROR: AddressSanitizer: heap-use-after-free on address 0x602000000010
+READ of size 1 at 0x602000000010 thread T0
+    #0 0x55d4a0 in __interceptor_memcpy ../sanitizer_common/sanitizer_common_interceptors.inc:827
+    #1 0x55d4a1 in lpGet /usr/local/redis/src/listpack.c:612
+    #2 0x55d4a2 in hashTypeGetValue /usr/local/redis/src/t_hash.c:701
+    #3 0x55d4a3 in hgetCommand /usr/local/redis/src/t_hash.c:866
+    #4 0x7f00a4 in __libc_start_main /lib/x86_64-linux-gnu/libc.so.6
+
+0x602000000010 is located 0 bytes inside of 16-byte region
+freed by thread T0 here:
+    #0 0x55d4b0 in free
+    #1 0x55d4b1 in zfree /usr/local/redis/src/zmalloc.c:300
+`
+
+// redis 7.2 segfault, main thread first, then bio threads
+const rediReport = `
+
+=== REDIS BUG REPORT START: Cut & paste starting from here ===
+4242:M 05 Mar 2024 10:11:12.345 # Redis 7.2.4 crashed by signal: 11, si_code: 1
+4242:M 05 Mar 2024 10:11:12.345 # Accessing address: 0x10
+4242:M 05 Mar 2024 10:11:12.345 # Crashed running the instruction at: 0x5581d0a3c9f2
+
+------ STACK TRACE ------
+EIP:
+redis-server *:6379(lpGet+0x22)[0x5581d0a3c9f2]
+
+4242 redis-server *
+/lib/x86_64-linux-gnu/libc.so.6(+0x42520)[0x7f6f5e442520]
+redis-server *:6379(lpGet+0x22)[0x5581d0a3c9f2]
+redis-server *:6379(hashTypeGetFromListpack+0x6c)[0x5581d0a1f0cc]
+redis-server *:6379(hashTypeGetValue+0x3e)[0x5581d0a1f4fe]
+redis-server *:6379(hgetCommand+0x5d)[0x5581d0a2237d]
+redis-server *:6379(call+0x16e)[0x5581d09a53be]
+redis-server *:6379(processCommand+0x8f5)[0x5581d09a6b25]
+redis-server *:6379(processInputBuffer+0xf3)[0x5581d09c50b3]
+redis-server *:6379(readQueryFromClient+0x328)[0x5581d09c55c8]
+redis-server *:6379(+0x1a7b8c)[0x5581d0aa4b8c]
+redis-server *:6379(aeProcessEvents+0x1f2)[0x5581d099a632]
+redis-server *:6379(aeMain+0x1d)[0x5581d099a8ad]
+redis-server *:6379(main+0x353)[0x5581d098f433]
+/lib/x86_64-linux-gnu/libc.so.6(+0x29d90)[0x7f6f5e429d90]
+/lib/x86_64-linux-gnu/libc.so.6(__libc_start_main+0x80)[0x7f6f5e429e40]
+redis-server *:6379(_start+0x25)[0x5581d098f9d5]
+
+4245 bio_lazy_free
+/lib/x86_64-linux-gnu/libc.so.6(+0x91117)[0x7f6f5e491117]
+/lib/x86_64-linux-gnu/libc.so.6(pthread_cond_wait+0x21a)[0x7f6f5e493a6a]
+redis-server *:6379(bioProcessBackgroundJobs+0x1a4)[0x5581d0a5d7f4]
+/lib/x86_64-linux-gnu/libc.so.6(+0x94ac3)[0x7f6f5e494ac3]
+/lib/x86_64-linux-gnu/libc.so.6(+0x126850)[0x7f6f5e526850]
+
+4/4 expected stacktraces.
+
+------ STACK TRACE DONE ------
+
+------ REGISTERS ------
+`
+
+// redis 7.2 assert, no EIP
+const rediAssert = `
+
+=== REDIS BUG REPORT START: Cut & paste starting from here ===
+4242:M 05 Mar 2024 10:11:12.345 # === ASSERTION FAILED ===
+4242:M 05 Mar 2024 10:11:12.345 # ==> t_string.c:596 'o->type == OBJ_STRING' is not true
+
+------ STACK TRACE ------
+
+4242 redis-server *
+redis-server *:6379(_serverAssert+0x95)[0x5581d09e1a25]
+redis-server *:6379(msetGenericCommand+0x1c9)[0x5581d0a0c6e9]
+redis-server *:6379(call+0x16e)[0x5581d09a53be]
+redis-server *:6379(processCommand+0x8f5)[0x5581d09a6b25]
+redis-server *:6379(processInputBuffer+0xf3)[0x5581d09c50b3]
+redis-server *:6379(readQueryFromClient+0x328)[0x5581d09c55c8]
+
+1/4 expected stacktraces.
+
+------ STACK TRACE DONE ------
+`
+
+func TestStackFrames(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		stderr string
+		want   []string
+	}{
+		{"asan first stack only", asanReport, []string{"lpGet", "hashTypeGetValue", "hgetCommand"}},
+		{"redis bug report", rediReport, []string{"lpGet", "hashTypeGetFromListpack", "hashTypeGetValue", "hgetCommand", "call",
+			"processCommand", "processInputBuffer", "readQueryFromClient", "aeProcessEvents", "aeMain", "main"}},
+		{"redis assert", rediAssert, []string{"msetGenericCommand", "call", "processCommand", "processInputBuffer", "readQueryFromClient"}},
+		{"no stack", "some log line\n", []string{}},
+	}
+
+	for _, tt := range tests {
+
+		got := StackFrames(tt.stderr)
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+
+	asan := Signature(asanReport)
+
+	// pid and addresses do not matter
+	other := strings.NewReplacer("4242", "977", "0x5581d0", "0x55aa00").Replace(rediReport)
+
+	if Signature(rediReport) != Signature(other) {
+		t.Errorf("bug report %s and %s differ", Signature(rediReport), Signature(other))
+	}
+
+	if Signature(rediReport) == Signature(rediAssert) {
+		t.Error("segfault and assert share a bucket")
+	}
+
+	if len(asan) != SIGNATURE_LEN {
+		t.Errorf("signature %s, want %d chars", asan, SIGNATURE_LEN)
+	}
+
+	// addresses do not matter
+	if Signature(asanReport+"\n==4243==") != asan {
+		t.Error("signature depends on trailing output")
+	}
+
+	if Signature("") != SignatureUnknown {
+		t.Errorf("empty stderr: %s", Signature(""))
+	}
+
+	// crash key fallback, log prefix in front
+	assert := "4242:M 05 Mar 2024 10:11:12.345 # ==> t_hash.c:42 'o != NULL' is not true\n"
+
+	if Signature(assert) == SignatureUnknown {
+		t.Error("assert without stack is unknown")
+	}
+}
+
+func TestCrashKey(t *testing.T) {
+
+	tests := []struct {
+		stderr string
+		want   string
+	}{
+		{asanReport, "ERROR: AddressSanitizer: heap-use-after-free on address 0x602000000010"},
+		{rediReport, "crashed by signal: 11, si_code: 1"},
+		{rediAssert, "==> t_string.c:596 'o->type == OBJ_STRING' is not true"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+
+		if got := CrashKey(tt.stderr); got != tt.want {
+			t.Errorf("%q, want %q", got, tt.want)
+		}
+	}
+}
+
+// the log is written to stdout when no logfile is set
+func TestRediStdout(t *testing.T) {
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report")
+
+	// work dir of the instance
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(cwd)
+
+	server := filepath.Join(dir, "redis-server")
+
+	if err := os.WriteFile(report, []byte(rediAssert), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "#!/bin/sh\ncat " + report + "\nkill -ABRT $$\n"
+
+	if err := os.WriteFile(server, []byte(script), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing listens on port 1
+	target := db.NewRedi(utils.TargetFeature{utils.TARGET_PATH: server, utils.TARGET_PORT: "1"})
+
+	if err := target.StartUp(); err == nil {
+		t.Fatal("startup of a crashing server succeeded")
+	}
+
+	stderr := target.Stderr()
+
+	if !reflect.DeepEqual(StackFrames(stderr), StackFrames(rediAssert)) {
+		t.Errorf("frames %v from %q", StackFrames(stderr), stderr)
+	}
+
+	if Signature(stderr) != Signature(rediAssert) {
+		t.Errorf("signature %s, want %s", Signature(stderr), Signature(rediAssert))
+	}
+}
@@ -0,0 +1,677 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+ * Cluster Definition
+ */
+
+/*	Cluster Struct	*/
+// masters on port, port+1 ...
+type Cluster struct {
+	nodes  []*Redi
+	client *redis.ClusterClient
+
+	// runtime ...
+	ids    []string
+	// one hash tag per node, keys of a sequence share one
+	tags   []string
+	slots  []int64
+	owner  int
+	// CLUSTER NODES myself slots, see CleanUp
+	layout []string
+
+	// node died last, see Stderr
+	died   int
+}
+
+// small local cluster
+const (
+	CLUSTER_NODES int   = 3
+	CLUSTER_SLOTS int64 = 16384
+)
+
+// cluster join
+const (
+	ClusterJoinTimeout time.Duration = 10 * time.Second
+	ClusterPoll        time.Duration = 10 * time.Millisecond
+	ClusterNodeTimeout string        = "5000"
+)
+
+// sequence owner, recorded in crash header
+type Sharder interface {
+	DB
+	Owner() int
+	SetOwner(int)
+}
+
+// slot migration seeds, replaced in Execute
+const (
+	ClusterSlot  string = "{slot}"
+	ClusterOwner string = "{owner}"
+	ClusterNode  string = "{node}"
+	ClusterHost  string = "{host}"
+	ClusterPort  string = "{port}"
+)
+
+/*
+ * Cluster Functions
+ */
+
+func NewCluster(feature utils.TargetFeature) *Cluster {
+
+	cluster := new(Cluster)
+
+	port, err := strconv.Atoi(feature[utils.TARGET_PORT])
+
+	if err != nil {
+		log.Fatalf("err: port %s %v", feature[utils.TARGET_PORT], err)
+	}
+
+	addrs := make([]string, 0, CLUSTER_NODES)
+
+	for i := 0; i < CLUSTER_NODES; i++ {
+
+		node := maps.Clone(feature)
+		node[utils.TARGET_PORT] = strconv.Itoa(port + i)
+
+		redi := NewRedi(node)
+
+		// one nodes.conf per instance
+		redi.args = append(redi.args,
+			"--cluster-enabled", "yes",
+			"--cluster-config-file", clusterConf(node[utils.TARGET_PORT]),
+			"--cluster-node-timeout", ClusterNodeTimeout,
+		)
+
+		cluster.nodes = append(cluster.nodes, redi)
+		addrs = append(addrs, redi.addr)
+	}
+
+	// cluster runtime
+	cluster.client = redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: addrs,
+		// blocking commands obey context deadline
+		ReadTimeout:           RediExecTimeout,
+		ContextTimeoutEnabled: true,
+	})
+
+	cluster.died = -1
+
+	return cluster
+}
+
+// private
+func clusterConf(port string) string {
+
+	return "nodes-" + port + ".conf"
+}
+
+/*
+ * Cluster Interface
+ */
+
+// public
+// fresh nodes, slots split evenly, meet, wait for cluster_state:ok
+func (self *Cluster) StartUp() error {
+
+	self.died = -1
+	self.owner = 0
+
+	for _, node := range self.nodes {
+
+		// old cluster state
+		_, port, _ := strings.Cut(node.addr, ":")
+		os.Remove(filepath.Join(node.dir, clusterConf(port)))
+
+		err := node.StartUp()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	size := CLUSTER_SLOTS / int64(len(self.nodes))
+
+	for i, node := range self.nodes {
+
+		first := int64(i) * size
+		last := first + size - 1
+
+		// last node takes the rest
+		if i == len(self.nodes)-1 {
+			last = CLUSTER_SLOTS - 1
+		}
+
+		_, err := node.client.Do(node.ctx, "CLUSTER", "ADDSLOTSRANGE", first, last).Result()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, node := range self.nodes[1:] {
+
+		host, port, _ := strings.Cut(node.addr, ":")
+		_, err := self.nodes[0].client.ClusterMeet(self.nodes[0].ctx, host, port).Result()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := self.waitJoin()
+
+	if err != nil {
+		return err
+	}
+
+	err = self.loadLayout()
+
+	if err != nil {
+		return err
+	}
+
+	// node ids changed
+	self.client.ReloadState(context.Background())
+
+	fmt.Printf("[*] cluster of %d nodes ok.\n", len(self.nodes))
+
+	return nil
+}
+
+// private
+func (self *Cluster) waitJoin() error {
+
+	deadline := time.Now().Add(ClusterJoinTimeout)
+
+	for time.Now().Before(deadline) {
+
+		if self.healthy() {
+			return nil
+		}
+
+		time.Sleep(ClusterPoll)
+	}
+
+	return errors.New("cluster join timeout.")
+}
+
+// private
+// all nodes see an ok cluster of all nodes
+func (self *Cluster) healthy() bool {
+
+	known := "cluster_known_nodes:" + strconv.Itoa(len(self.nodes))
+
+	for _, node := range self.nodes {
+
+		info, err := node.client.ClusterInfo(node.ctx).Result()
+
+		if err != nil {
+			return false
+		}
+
+		if !strings.Contains(info, "cluster_state:ok") || !strings.Contains(info, known) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// private
+// node ids, hash tag per node, slots of each node
+func (self *Cluster) loadLayout() error {
+
+	self.ids = make([]string, len(self.nodes))
+	self.tags = make([]string, len(self.nodes))
+	self.slots = make([]int64, len(self.nodes))
+
+	for i, node := range self.nodes {
+
+		id, err := node.client.Do(node.ctx, "CLUSTER", "MYID").Text()
+
+		if err != nil {
+			return err
+		}
+
+		self.ids[i] = id
+	}
+
+	size := CLUSTER_SLOTS / int64(len(self.nodes))
+	found := 0
+
+	// first tag falls into each node
+	for n := 0; found < len(self.nodes); n++ {
+
+		tag := strconv.Itoa(n)
+		slot, err := self.nodes[0].client.ClusterKeySlot(self.nodes[0].ctx, tag).Result()
+
+		if err != nil {
+			return err
+		}
+
+		i := min(int(slot/size), len(self.nodes)-1)
+
+		if self.tags[i] == "" {
+			self.tags[i] = "{" + tag + "}"
+			self.slots[i] = slot
+			found++
+		}
+	}
+
+	layout, err := self.myslots()
+
+	if err != nil {
+		return err
+	}
+
+	self.layout = layout
+
+	return nil
+}
+
+// private
+// myself line of CLUSTER NODES, slots and migrating state
+func (self *Cluster) myslots() ([]string, error) {
+
+	layout := make([]string, len(self.nodes))
+
+	for i, node := range self.nodes {
+
+		nodes, err := node.client.ClusterNodes(node.ctx).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(nodes, "\n") {
+
+			fields := strings.Fields(line)
+
+			if len(fields) > 2 && strings.Contains(fields[2], "myself") {
+				layout[i] = strings.Join(fields[min(8, len(fields)):], " ")
+			}
+		}
+	}
+
+	return layout, nil
+}
+
+// public
+func (self *Cluster) Restart() error {
+
+	self.ShutDown()
+
+	fmt.Println("[*] waiting cluster restart...")
+
+	return self.StartUp()
+}
+
+// public
+func (self *Cluster) ShutDown() {
+
+	for _, node := range self.nodes {
+		node.ShutDown()
+	}
+}
+
+// public
+func (self *Cluster) CheckAlive() bool {
+
+	for _, node := range self.nodes {
+
+		if !node.CheckAlive() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// public
+// flush every node, next tag, restart if slots were moved
+func (self *Cluster) CleanUp() error {
+
+	for _, node := range self.nodes {
+
+		err := node.CleanUp()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	self.owner = (self.owner + 1) % len(self.nodes)
+
+	layout, err := self.myslots()
+
+	if err == nil && slices.Equal(layout, self.layout) && self.healthy() {
+		return nil
+	}
+
+	return self.Restart()
+}
+
+// public
+// node of tags and placeholders until next CleanUp
+func (self *Cluster) Owner() int {
+
+	return self.owner
+}
+
+// public
+// replay, CleanUp moved to the next node
+func (self *Cluster) SetOwner(owner int) {
+
+	if owner >= 0 && owner < len(self.nodes) {
+		self.owner = owner
+	}
+}
+
+// public
+// CLUSTER and MIGRATE go to the owner of the tag, FUNCTION to all, the rest is routed
+func (self *Cluster) Execute(tokens []string) (utils.TargetState, error) {
+
+	tokens = self.tagKeys(self.placeholders(tokens))
+
+	// FCALL runs on the node of its keys
+	if self.broadcast(tokens) {
+		return self.executeAll(tokens)
+	}
+
+	index := self.route(tokens)
+
+	if index >= 0 {
+
+		_, state, err := self.nodes[index].ExecuteReply(tokens)
+
+		if state == utils.STATE_CRASH || state == utils.STATE_HANG {
+			self.died = index
+		}
+
+		return state, err
+	}
+
+	// marshal string
+	args := []interface{}{}
+
+	for _, token := range tokens {
+		args = append(args, token)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RediExecTimeout)
+	defer cancel()
+
+	_, err := self.client.Do(ctx, args...).Result()
+
+	// execute failed
+	if err != nil && err != redis.Nil {
+		return self.failState(), err
+	}
+
+	return utils.STATE_OK, err
+}
+
+// private
+// slot of the tag, ids and address of the owner and its peer
+func (self *Cluster) placeholders(tokens []string) []string {
+
+	peer := (self.owner + 1) % len(self.nodes)
+	host, port, _ := strings.Cut(self.nodes[peer].addr, ":")
+
+	replacer := strings.NewReplacer(
+		ClusterSlot, strconv.FormatInt(self.slots[self.owner], 10),
+		ClusterOwner, self.ids[self.owner],
+		ClusterNode, self.ids[peer],
+		ClusterHost, host,
+		ClusterPort, port,
+	)
+
+	out := make([]string, len(tokens))
+
+	for i, token := range tokens {
+		out[i] = replacer.Replace(token)
+	}
+
+	return out
+}
+
+// private
+// COMMAND GETKEYS, every key gets the tag of this sequence
+func (self *Cluster) tagKeys(tokens []string) []string {
+
+	if len(tokens) < 2 {
+		return tokens
+	}
+
+	node := self.nodes[self.owner]
+
+	args := []interface{}{"COMMAND", "GETKEYS"}
+
+	for _, token := range tokens {
+		args = append(args, token)
+	}
+
+	ctx, cancel := context.WithTimeout(node.ctx, RediExecTimeout)
+	defer cancel()
+
+	keys, err := node.client.Do(ctx, args...).StringSlice()
+
+	// no keys
+	if err != nil || len(keys) == 0 {
+		return tokens
+	}
+
+	out := make([]string, len(tokens))
+	copy(out, tokens)
+
+	for i := 1; i < len(out); i++ {
+
+		for _, key := range keys {
+
+			if out[i] == key {
+				out[i] = self.tags[self.owner] + key
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// private
+// node of a node-local command, -1 is routed by the cluster client
+func (self *Cluster) route(tokens []string) int {
+
+	cmd := strings.ToUpper(tokens[0])
+
+	switch cmd {
+
+	case "CLUSTER":
+
+		// importing side is the peer
+		if len(tokens) > 3 && strings.ToUpper(tokens[1]) == "SETSLOT" && strings.ToUpper(tokens[3]) == "IMPORTING" {
+			return (self.owner + 1) % len(self.nodes)
+		}
+
+		return self.owner
+
+	case "MIGRATE":
+		return self.owner
+	}
+
+	return -1
+}
+
+// private
+// libraries must exist on every primary
+func (self *Cluster) broadcast(tokens []string) bool {
+
+	if len(tokens) < 2 || strings.ToUpper(tokens[0]) != "FUNCTION" {
+		return false
+	}
+
+	switch strings.ToUpper(tokens[1]) {
+	case "LOAD", "FLUSH", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+// private
+// each node in order, stop at crash or hang
+func (self *Cluster) executeAll(tokens []string) (utils.TargetState, error) {
+
+	var state utils.TargetState
+	var err error
+
+	for i, node := range self.nodes {
+
+		_, state, err = node.ExecuteReply(tokens)
+
+		if state == utils.STATE_CRASH || state == utils.STATE_HANG {
+			self.died = i
+			break
+		}
+	}
+
+	return state, err
+}
+
+// private
+// which node died
+func (self *Cluster) failState() utils.TargetState {
+
+	for i, node := range self.nodes {
+
+		if !node.CheckAlive() {
+			self.died = i
+			return node.failState()
+		}
+	}
+
+	return utils.STATE_ERR
+}
+
+// public
+// keys of all nodes, tags stripped
+func (self *Cluster) Collect() (model.Snapshot, error) {
+
+	snapshot := make(model.Snapshot, 0)
+
+	for _, node := range self.nodes {
+
+		part, err := node.Collect()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for key, values := range part {
+
+			key = self.untag(key)
+
+			for _, value := range values {
+				snapshot[key] = append(snapshot[key], self.untag(value))
+			}
+
+			// key without members
+			_, ok := snapshot[key]
+
+			if !ok {
+				snapshot[key] = make([]model.Token, 0)
+			}
+		}
+	}
+
+	return snapshot, nil
+}
+
+// private
+func (self *Cluster) untag(token model.Token) model.Token {
+
+	for _, tag := range self.tags {
+
+		text, ok := strings.CutPrefix(token.Text, tag)
+
+		if ok {
+			token.Text = text
+			break
+		}
+	}
+
+	return token
+}
+
+// public
+func (self *Cluster) Schema() (model.Schema, error) {
+
+	return self.nodes[0].Schema()
+}
+
+// public
+// stderr of the node died
+func (self *Cluster) Stderr() string {
+
+	if self.died < 0 {
+		return self.nodes[0].Stderr()
+	}
+
+	node := self.nodes[self.died]
+	_, port, _ := strings.Cut(node.addr, ":")
+
+	return "node: " + port + "\n" + node.Stderr()
+}
+
+// public
+func (self *Cluster) Name() string {
+
+	return self.nodes[0].Name()
+}
+
+// public
+func (self *Cluster) LineSep() string {
+
+	return RediLineSep
+}
+
+// public
+func (self *Cluster) TokenSep() string {
+
+	return RediTokenSep
+}
+
+// public
+func (self *Cluster) Pid() int {
+
+	return self.nodes[0].Pid()
+}
+
+// public
+func (self *Cluster) Debug() {
+
+	log.Println("==== Cluster ====")
+	log.Printf("tags: %v\n", self.tags)
+
+	for _, node := range self.nodes {
+		node.Debug()
+	}
+}
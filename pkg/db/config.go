@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+)
+
+// runtime config, CONFIG GET *
+type Configurer interface {
+	DB
+	Config() (map[string]string, error)
+}
+
+/*
+ * Redi Config Functions
+ */
+
+// public
+func (self *Redi) Config() (map[string]string, error) {
+
+	ctx, cancel := context.WithTimeout(self.ctx, RediExecTimeout)
+	defer cancel()
+
+	return self.client.ConfigGet(ctx, "*").Result()
+}
+
+// public
+// master only, CONFIG SET is not replicated
+func (self *Repl) Config() (map[string]string, error) {
+
+	return self.master.Config()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+)
+
+// command grammar
+type Documenter interface {
+	DB
+	Schema() (model.Schema, error)
+}
+
+/*
+ * Redi Docs Functions
+ */
+
+// public
+// COMMAND INFO key positions, COMMAND DOCS arguments
+func (self *Redi) Schema() (model.Schema, error) {
+
+	infos, err := self.client.Command(self.ctx).Result()
+
+	// command info failed
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(model.Schema, len(infos))
+
+	for _, info := range infos {
+
+		name := strings.ToUpper(info.Name)
+
+		schema[name] = &model.CommandSchema{
+			Name:     name,
+			Arity:    int(info.Arity),
+			FirstKey: int(info.FirstKeyPos),
+			LastKey:  int(info.LastKeyPos),
+			Step:     int(info.StepCount),
+		}
+	}
+
+	docs, err := self.client.Do(self.ctx, "COMMAND", "DOCS").Result()
+
+	// keydb, old redis, info only
+	if err != nil {
+		return schema, nil
+	}
+
+	for name, doc := range replyMap(docs) {
+		addDoc(schema, name, doc)
+	}
+
+	for _, cs := range schema {
+		cs.Link()
+	}
+
+	return schema, nil
+}
+
+// private
+// "config|get" subcommands are added too
+func addDoc(schema model.Schema, name string, doc interface{}) {
+
+	fields := replyMap(doc)
+	name = strings.ToUpper(name)
+
+	cs, ok := schema[name]
+
+	// subcommand without info
+	if !ok {
+		cs = &model.CommandSchema{Name: name}
+		schema[name] = cs
+	}
+
+	cs.Args = docArgs(fields["arguments"])
+
+	for sub, subDoc := range replyMap(fields["subcommands"]) {
+		addDoc(schema, sub, subDoc)
+	}
+}
+
+// private
+func docArgs(value interface{}) []*model.Arg {
+
+	list, ok := value.([]interface{})
+
+	if !ok {
+		return nil
+	}
+
+	args := make([]*model.Arg, 0, len(list))
+
+	for _, item := range list {
+
+		fields := replyMap(item)
+
+		arg := &model.Arg{
+			Name:  replyString(fields["name"]),
+			Type:  replyString(fields["type"]),
+			Token: replyString(fields["token"]),
+			Args:  docArgs(fields["arguments"]),
+		}
+
+		flags, _ := fields["flags"].([]interface{})
+
+		for _, flag := range flags {
+
+			switch replyString(flag) {
+			case "optional":
+				arg.Optional = true
+			case "multiple":
+				arg.Multiple = true
+			}
+		}
+
+		args = append(args, arg)
+	}
+
+	return args
+}
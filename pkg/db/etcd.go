@@ -8,11 +8,15 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/fuxxcss/Etcd2fuzz/pkg/model"
-	"github.com/fuxxcss/Etcd2fuzz/pkg/utils"
-	"go.etcd.io/etcd/client/v3"
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 /*
@@ -23,13 +27,23 @@ import (
 type Etcd struct {
 
 	// proc ...
+	name   string
 	path   string
 	args   []string
+	env    []string
+	dir    string
 	stderr bytes.Buffer
 	proc   *exec.Cmd
+	done   chan struct{}
+	// readiness timeout
+	ready  time.Duration
+	// running pid, read by metrics
+	pid    atomic.Int64
 
 	// runtime ...
 	client *clientv3.Client
+	// granted in this sequence, newest last, see EtcdLease
+	leases []clientv3.LeaseID
 	ctx    context.Context
 }
 
@@ -38,16 +52,26 @@ const (
 	EtcdTokenSep string = " "
 )
 
+// etcd timeout
+const (
+	EtcdTimeout     time.Duration = 5 * time.Second
+	EtcdExitTimeout time.Duration = 10 * time.Second
+	EtcdReadyTimeout time.Duration = 30 * time.Second
+	// peer port = client port + offset
+	ETCD_PEER_OFFSET int = 10000
+)
+
+// newest granted lease, e.g. put k v --lease={lease}
+const (
+	EtcdLease string = "{lease}"
+)
+
 /*
  * Etcd Functions
  */
 
 func NewEtcd(feature utils.TargetFeature) *Etcd {
 
-	// set global sep
-	model.LineSep = EtcdLineSep
-	model.TokenSep = EtcdTokenSep
-
 	etcd := new(Etcd)
 
 	// path, port
@@ -64,11 +88,42 @@ func NewEtcd(feature utils.TargetFeature) *Etcd {
 	}
 
 	etcd.path = path
+	etcd.name = feature[utils.TARGET_NAME]
+	etcd.ready = feature.Ready(EtcdReadyTimeout)
+
+	// e.g. ASAN_OPTIONS
+	etcd.env = feature.Env()
+
+	// afl coverage map
+	id, ok := feature[utils.COVERAGE_ID]
+
+	if ok {
+		etcd.env = append(etcd.env,
+			utils.CoverageEnv + "=" + id,
+			utils.AflShmEnv + "=" + id,
+		)
+	}
+
+	portNum, err := strconv.Atoi(port)
+
+	if err != nil {
+		log.Fatalf("err: port %s %v", port, err)
+	}
+
+	// data dir, one per instance
+	etcd.dir, err = os.MkdirTemp("", "r2f-etcd-"+port+"-")
+
+	if err != nil {
+		log.Fatalf("err: data dir %v", err)
+	}
+
+	client := "http://127.0.0.1:" + port
+	peer := "http://127.0.0.1:" + strconv.Itoa(portNum+ETCD_PEER_OFFSET)
 
 	// Etcd runtime
 	etcd.client, err = clientv3.New(clientv3.Config{
-		Endpoints:   []string{"127.0.0.1:" + port},
-		DialTimeout: 5 * time.Second,
+		Endpoints:   []string{client},
+		DialTimeout: EtcdTimeout,
 	})
 
 	if err != nil {
@@ -77,20 +132,21 @@ func NewEtcd(feature utils.TargetFeature) *Etcd {
 
 	etcd.ctx = context.Background()
 
-	// check alive
-	alive := etcd.CheckAlive()
-
-	// already startup, shutdown first
-	if alive {
-		etcd.client.Do(etcd.ctx, "shutdown")
-	}
-
 	// Etcd args
 	etcd.args = []string{
-		// port
-		"--port" + " " + port,
+		"--name", "r2f-" + port,
+		"--data-dir", etcd.dir,
+		"--listen-client-urls", client,
+		"--advertise-client-urls", client,
+		"--listen-peer-urls", peer,
+		"--initial-advertise-peer-urls", peer,
+		"--initial-cluster", "r2f-" + port + "=" + peer,
+		"--initial-cluster-state", "new",
 	}
 
+	// extra args
+	etcd.args = append(etcd.args, strings.Fields(feature[utils.TARGET_ARGS])...)
+
 	return etcd
 
 }
@@ -103,24 +159,61 @@ func NewEtcd(feature utils.TargetFeature) *Etcd {
 // public
 func (self *Etcd) StartUp() error {
 
+	// fresh data dir
+	os.RemoveAll(self.dir)
+	err := os.MkdirAll(self.dir, 0700)
+
+	if err != nil {
+		return err
+	}
+
+	self.stderr.Reset()
+
 	self.proc = exec.Command(self.path, self.args...)
+	self.proc.Env = append(os.Environ(), self.env...)
 	self.proc.Stderr = &self.stderr
 
 	// error
-	err := self.proc.Start()
+	err = self.proc.Start()
 
 	// startup failed
 	if err != nil {
 		return err
 	}
 
+	// reap etcd
+	self.done = make(chan struct{})
+
+	pid := int64(self.proc.Process.Pid)
+	self.pid.Store(pid)
+
+	go func(proc *exec.Cmd, done chan struct{}) {
+		proc.Wait()
+		self.pid.CompareAndSwap(pid, 0)
+		close(done)
+	}(self.proc, self.done)
+
 	// waiting Etcd startup
 	fmt.Println("[*] waiting Etcd startup...")
+	deadline := time.Now().Add(self.ready)
+
 	for {
 		alive := self.CheckAlive()
 		if alive {
 			break
 		}
+
+		// exit early
+		select {
+		case <-self.done:
+			return errors.New("etcd exit on startup.")
+		default:
+		}
+
+		if time.Now().After(deadline) {
+			self.ShutDown()
+			return fmt.Errorf("etcd not ready after %v.", self.ready)
+		}
 	}
 
 	// succeed
@@ -132,41 +225,38 @@ func (self *Etcd) StartUp() error {
 // public
 func (self *Etcd) Restart() error {
 
-	err := self.proc.Start()
-
-	// restart failed
-	if err != nil {
-		return err
-	}
+	// old etcd may be alive
+	self.ShutDown()
 
-	// waiting Etcd restart
 	fmt.Println("[*] waiting Etcd restart...")
-	for {
-		alive := self.CheckAlive()
-		if alive {
-			break
-		}
-	}
-
-	// db succeed
-	fmt.Printf("[*] Etcd %v ReStart.\n", self.path)
 
-	return nil
+	return self.StartUp()
 }
 
 // public
 func (self *Etcd) ShutDown() {
 
+	// data dir of MkdirTemp, StartUp makes it again
+	defer os.RemoveAll(self.dir)
+
+	if self.proc == nil || self.proc.Process == nil {
+		return
+	}
+
 	// kill Etcd
 	self.proc.Process.Kill()
+	<-self.done
 
 }
 
 // public
 func (self *Etcd) CheckAlive() bool {
 
+	ctx, cancel := context.WithTimeout(self.ctx, time.Second)
+	defer cancel()
+
 	// Etcd state
-	_, err := self.client.Status(self.ctx, self.client.Endpoints()[0])
+	_, err := self.client.Status(ctx, self.client.Endpoints()[0])
 
 	// Etcd is not alive
 	if err != nil {
@@ -179,108 +269,172 @@ func (self *Etcd) CheckAlive() bool {
 // public
 func (self *Etcd) CleanUp() error {
 
-	_, err := self.client.Delete(self.ctx, "", clientv3.WithPrefix())
+	ctx, cancel := context.WithTimeout(self.ctx, EtcdTimeout)
+	defer cancel()
+
+	_, err := self.client.Delete(ctx, "", clientv3.WithPrefix())
 
-	// flushall failed
+	// delete all failed
 	if err != nil {
 		return err
 	}
 
+	// revoke all leases
+	leases, err := self.client.Leases(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, lease := range leases.Leases {
+		self.client.Revoke(ctx, lease.ID)
+	}
+
+	self.leases = nil
+
 	return nil
 }
 
 // public
 func (self *Etcd) Execute(tokens []string) (utils.TargetState, error) {
 
-	// marshal string
-	args := []interface{}{}
+	// parse line, queue lines don't know lease ids
+	op, err := ParseEtcdLine(self.repairLease(tokens))
 
-	for _, token := range tokens {
-		args = append(args, token)
+	// bad line, not the target's fault
+	if err != nil {
+		return utils.STATE_ERR, err
 	}
 
+	ctx, cancel := context.WithTimeout(self.ctx, EtcdTimeout)
+	defer cancel()
+
 	// state
 	state := utils.STATE_OK
 
-	_, err := self.client.Do(self.ctx, args...).Result()
+	err = op(ctx, self.client)
 
 	// execute failed
-	if err != nil && err != Etcds.Nil {
+	if err != nil {
+		state = self.failState()
+		return state, err
+	}
+
+	// lease grant
+	if len(tokens) > 1 && strings.EqualFold(tokens[0], "lease") && strings.EqualFold(tokens[1], "grant") {
+		self.trackLeases(ctx)
+	}
+
+	return state, err
+
+}
+
+// private
+// {lease} -> newest granted id, 0 if none
+func (self *Etcd) repairLease(tokens []string) []string {
+
+	id := "0"
+
+	if len(self.leases) > 0 {
+		id = strconv.FormatInt(int64(self.leases[len(self.leases)-1]), 16)
+	}
 
-		// execute error
-		if self.CheckAlive() {
-			state = utils.STATE_ERR
+	ret := make([]string, 0, len(tokens))
 
-			// crash
-		} else {
-			state = utils.STATE_CRASH
+	for _, token := range tokens {
+		ret = append(ret, strings.ReplaceAll(token, EtcdLease, id))
+	}
+
+	return ret
+}
+
+// private
+// new ids of lease list, grant response is not kept by EtcdOp
+func (self *Etcd) trackLeases(ctx context.Context) {
+
+	resp, err := self.client.Leases(ctx)
+
+	if err != nil {
+		return
+	}
+
+	for _, lease := range resp.Leases {
+
+		if !slices.Contains(self.leases, lease.ID) {
+			self.leases = append(self.leases, lease.ID)
 		}
 	}
+}
 
-	return state, err
+// private
+// answers status: error, exits: crash, still running: hang
+func (self *Etcd) failState() utils.TargetState {
+
+	if self.CheckAlive() {
+		return utils.STATE_ERR
+	}
 
+	select {
+	case <-self.done:
+		return utils.STATE_CRASH
+	case <-time.After(EtcdExitTimeout):
+		return utils.STATE_HANG
+	}
 }
 
 // public
+// key (level 1) ---> attached lease, create, mod revision and version (level 2)
 func (self *Etcd) Collect() (model.Snapshot, error) {
 
+	ctx, cancel := context.WithTimeout(self.ctx, EtcdTimeout)
+	defer cancel()
+
 	// snapshot
 	snapshot := make(model.Snapshot, 0)
 
-	keys, _ := self.client.Keys(self.ctx, "*").Result()
+	resp, err := self.client.Get(ctx, "", clientv3.WithPrefix(), clientv3.WithKeysOnly())
 
-	// Etcds stack query engine, type = "none"
-	ft, err := self.client.Do(self.ctx, "FT._LIST").Text()
-
-	if err == nil {
-		keys = append(keys, ft)
+	if err != nil {
+		return nil, errors.New("collect keys failed.")
 	}
 
-	// keys
-	for _, key := range keys {
+	for _, kv := range resp.Kvs {
 
-		keyType, err := self.client.Type(self.ctx, key).Result()
-
-		// Type failed
-		if err != nil {
-			return nil, errors.New("TYPE key failed.")
+		keyToken := model.Token{
+			Level: model.TOKEN_LEVEL_1,
+			Text:  string(kv.Key),
 		}
 
-		// special key
-		fmap := map[string]func(string, *model.Snapshot) error{
-			"hash": self.collectHash,
-			// "geo" : collect geo,
-			"stream": self.collectStream,
-			// "none" : collect ft,
-			// "TSDB-TYPE" : collect ts,
-		}
+		_, ok := snapshot[keyToken]
 
-		f, ok := fmap[keyType]
+		if !ok {
+			snapshot[keyToken] = make([]model.Token, 0)
+		}
 
-		// special key
-		if ok {
-			err := f(key, &snapshot)
+		// --rev=, compact, txn create|mod|version
+		for _, rev := range []int64{kv.CreateRevision, kv.ModRevision, kv.Version} {
 
-			// failed
-			if err != nil {
-				return nil, err
+			revToken := model.Token{
+				Level: model.TOKEN_LEVEL_2,
+				Text:  strconv.FormatInt(rev, 10),
 			}
 
-			// common key
-		} else {
-
-			keyToken := model.Token{
-				Level: model.TOKEN_LEVEL_1,
-				Text:  key,
+			if !slices.Contains(snapshot[keyToken], revToken) {
+				snapshot[keyToken] = append(snapshot[keyToken], revToken)
 			}
+		}
 
-			_, ok := snapshot[keyToken]
+		// no lease
+		if kv.Lease == 0 {
+			continue
+		}
 
-			if !ok {
-				snapshot[keyToken] = make([]model.Token, 0)
-			}
+		leaseToken := model.Token{
+			Level: model.TOKEN_LEVEL_2,
+			Text:  strconv.FormatInt(kv.Lease, 16),
 		}
 
+		snapshot[keyToken] = append(snapshot[keyToken], leaseToken)
 	}
 
 	return snapshot, nil
@@ -289,13 +443,49 @@ func (self *Etcd) Collect() (model.Snapshot, error) {
 // public
 func (self *Etcd) Stderr() string {
 
+	// crashed, wait for the whole report
+	if self.done != nil && !self.CheckAlive() {
+
+		select {
+		case <-self.done:
+		case <-time.After(EtcdExitTimeout):
+		}
+	}
+
 	return self.stderr.String()
 }
 
+// public
+// 0 if not running
+func (self *Etcd) Pid() int {
+
+	return int(self.pid.Load())
+}
+
+// public
+func (self *Etcd) Name() string {
+
+	return self.name
+}
+
+// public
+func (self *Etcd) LineSep() string {
+
+	return EtcdLineSep
+}
+
+// public
+func (self *Etcd) TokenSep() string {
+
+	return EtcdTokenSep
+}
+
 // public
 func (self *Etcd) Debug() {
 
 	log.Println("==== Etcd ====")
+	log.Printf("name: %s\n", self.name)
 	log.Printf("path: %s\n", self.path)
 	log.Printf("args: %v\n", self.args)
+	log.Printf("env: %v\n", self.env)
 }
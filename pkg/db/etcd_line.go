@@ -0,0 +1,366 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+/*
+ * Etcd Line Definition
+ */
+
+// one queue line, etcdctl like
+//   put k v [--lease=id] [--prev-kv] [--ignore-value] [--ignore-lease], id is hex or {lease}
+//   get k [end] [--prefix] [--from-key] [--rev=n] [--limit=n] [--keys-only] [--count-only]
+//   del k [end] [--prefix] [--from-key] [--prev-kv]
+//   txn [value|version|create|mod|lease k =|!=|>|< v]... then [op]... else [op]...
+//   lease grant ttl | lease revoke id | lease keep-alive id | lease timetolive id [--keys] | lease list
+//   compact rev [--physical]
+type EtcdOp func(context.Context, *clientv3.Client) error
+
+/*
+ * Etcd Line Functions
+ */
+
+// public
+func ParseEtcdLine(tokens []string) (EtcdOp, error) {
+
+	if len(tokens) == 0 {
+		return nil, errors.New("empty line.")
+	}
+
+	args, flags := splitFlags(tokens[1:])
+
+	switch strings.ToLower(tokens[0]) {
+
+	case "put", "get", "del", "delete":
+		op, err := parseOp(strings.ToLower(tokens[0]), args, flags)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.Do(ctx, op)
+			return err
+		}, nil
+
+	case "txn":
+		return parseTxn(tokens[1:])
+
+	case "lease":
+		return parseLease(args, flags)
+
+	case "compact":
+		if len(args) != 1 {
+			return nil, errors.New("compact rev.")
+		}
+
+		rev, err := strconv.ParseInt(args[0], 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts := make([]clientv3.CompactOption, 0)
+
+		if _, ok := flags["physical"]; ok {
+			opts = append(opts, clientv3.WithCompactPhysical())
+		}
+
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.Compact(ctx, rev, opts...)
+			return err
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown command %s.", tokens[0])
+}
+
+// private
+// --name=value, --name
+func splitFlags(tokens []string) ([]string, map[string]string) {
+
+	args := make([]string, 0)
+	flags := make(map[string]string, 0)
+
+	for _, token := range tokens {
+
+		if !strings.HasPrefix(token, "--") {
+			args = append(args, token)
+			continue
+		}
+
+		name, value, _ := strings.Cut(token[2:], "=")
+		flags[name] = value
+	}
+
+	return args, flags
+}
+
+// private
+func parseOp(cmd string, args []string, flags map[string]string) (clientv3.Op, error) {
+
+	opts := make([]clientv3.OpOption, 0)
+
+	for name, value := range flags {
+
+		switch name {
+
+		case "prefix":
+			opts = append(opts, clientv3.WithPrefix())
+		case "from-key":
+			opts = append(opts, clientv3.WithFromKey())
+		case "keys-only":
+			opts = append(opts, clientv3.WithKeysOnly())
+		case "count-only":
+			opts = append(opts, clientv3.WithCountOnly())
+		case "prev-kv":
+			opts = append(opts, clientv3.WithPrevKV())
+		case "ignore-value":
+			opts = append(opts, clientv3.WithIgnoreValue())
+		case "ignore-lease":
+			opts = append(opts, clientv3.WithIgnoreLease())
+
+		case "rev", "limit":
+			n, err := strconv.ParseInt(value, 10, 64)
+
+			if err != nil {
+				return clientv3.Op{}, err
+			}
+
+			if name == "rev" {
+				opts = append(opts, clientv3.WithRev(n))
+			} else {
+				opts = append(opts, clientv3.WithLimit(n))
+			}
+
+		case "lease":
+			id, err := strconv.ParseInt(value, 16, 64)
+
+			if err != nil {
+				return clientv3.Op{}, err
+			}
+
+			opts = append(opts, clientv3.WithLease(clientv3.LeaseID(id)))
+
+		default:
+			return clientv3.Op{}, fmt.Errorf("unknown flag --%s.", name)
+		}
+	}
+
+	switch cmd {
+
+	case "put":
+		if len(args) != 2 {
+			return clientv3.Op{}, errors.New("put key value.")
+		}
+
+		return clientv3.OpPut(args[0], args[1], opts...), nil
+
+	case "get", "del", "delete":
+		if len(args) < 1 || len(args) > 2 {
+			return clientv3.Op{}, fmt.Errorf("%s key [end].", cmd)
+		}
+
+		// range end
+		if len(args) == 2 {
+			opts = append(opts, clientv3.WithRange(args[1]))
+		}
+
+		if cmd == "get" {
+			return clientv3.OpGet(args[0], opts...), nil
+		}
+
+		return clientv3.OpDelete(args[0], opts...), nil
+	}
+
+	return clientv3.Op{}, fmt.Errorf("unknown op %s.", cmd)
+}
+
+// private
+func parseTxn(tokens []string) (EtcdOp, error) {
+
+	cmps := make([]clientv3.Cmp, 0)
+	thenOps := make([]clientv3.Op, 0)
+	elseOps := make([]clientv3.Op, 0)
+
+	// compares until then
+	i := 0
+
+	for ; i < len(tokens) && strings.ToLower(tokens[i]) != "then"; i += 4 {
+
+		if i+4 > len(tokens) {
+			return nil, errors.New("txn compare: target key op value.")
+		}
+
+		cmp, err := parseCmp(tokens[i : i+4])
+
+		if err != nil {
+			return nil, err
+		}
+
+		cmps = append(cmps, cmp)
+	}
+
+	// skip then
+	i++
+
+	ops := &thenOps
+
+	for i < len(tokens) {
+
+		cmd := strings.ToLower(tokens[i])
+
+		if cmd == "else" {
+			ops = &elseOps
+			i++
+			continue
+		}
+
+		// put k v, get k, del k
+		arity := 2
+
+		if cmd == "put" {
+			arity = 3
+		}
+
+		if i+arity > len(tokens) {
+			return nil, fmt.Errorf("txn op %s.", cmd)
+		}
+
+		args, flags := splitFlags(tokens[i+1 : i+arity])
+		op, err := parseOp(cmd, args, flags)
+
+		if err != nil {
+			return nil, err
+		}
+
+		*ops = append(*ops, op)
+		i += arity
+	}
+
+	return func(ctx context.Context, client *clientv3.Client) error {
+		_, err := client.Txn(ctx).If(cmps...).Then(thenOps...).Else(elseOps...).Commit()
+		return err
+	}, nil
+}
+
+// private
+// value|version|create|mod|lease key op value
+func parseCmp(tokens []string) (clientv3.Cmp, error) {
+
+	key, op, value := tokens[1], tokens[2], tokens[3]
+
+	switch op {
+	case "=", "!=", ">", "<":
+	default:
+		return clientv3.Cmp{}, fmt.Errorf("txn compare op %s.", op)
+	}
+
+	if strings.ToLower(tokens[0]) == "value" {
+		return clientv3.Compare(clientv3.Value(key), op, value), nil
+	}
+
+	base := 10
+
+	if strings.ToLower(tokens[0]) == "lease" {
+		base = 16
+	}
+
+	n, err := strconv.ParseInt(value, base, 64)
+
+	if err != nil {
+		return clientv3.Cmp{}, err
+	}
+
+	switch strings.ToLower(tokens[0]) {
+	case "version":
+		return clientv3.Compare(clientv3.Version(key), op, n), nil
+	case "create":
+		return clientv3.Compare(clientv3.CreateRevision(key), op, n), nil
+	case "mod":
+		return clientv3.Compare(clientv3.ModRevision(key), op, n), nil
+	case "lease":
+		return clientv3.Compare(clientv3.LeaseValue(key), op, clientv3.LeaseID(n)), nil
+	}
+
+	return clientv3.Cmp{}, fmt.Errorf("txn compare target %s.", tokens[0])
+}
+
+// private
+func parseLease(args []string, flags map[string]string) (EtcdOp, error) {
+
+	if len(args) == 0 {
+		return nil, errors.New("lease subcommand.")
+	}
+
+	// lease list
+	if strings.ToLower(args[0]) == "list" {
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.Leases(ctx)
+			return err
+		}, nil
+	}
+
+	if len(args) != 2 {
+		return nil, fmt.Errorf("lease %s arg.", args[0])
+	}
+
+	switch strings.ToLower(args[0]) {
+
+	case "grant":
+		ttl, err := strconv.ParseInt(args[1], 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.Grant(ctx, ttl)
+			return err
+		}, nil
+	}
+
+	n, err := strconv.ParseInt(args[1], 16, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := clientv3.LeaseID(n)
+
+	switch strings.ToLower(args[0]) {
+
+	case "revoke":
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.Revoke(ctx, id)
+			return err
+		}, nil
+
+	case "keep-alive":
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.KeepAliveOnce(ctx, id)
+			return err
+		}, nil
+
+	case "timetolive":
+		opts := make([]clientv3.LeaseOption, 0)
+
+		if _, ok := flags["keys"]; ok {
+			opts = append(opts, clientv3.WithAttachedKeys())
+		}
+
+		return func(ctx context.Context, client *clientv3.Client) error {
+			_, err := client.TimeToLive(ctx, id, opts...)
+			return err
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown lease %s.", args[0])
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+func TestRepairLease(t *testing.T) {
+
+	etcd := new(Etcd)
+	line := []string{"put", "k", "v", "--lease=" + EtcdLease}
+
+	// nothing granted yet
+	got := etcd.repairLease(line)
+
+	if !reflect.DeepEqual(got, []string{"put", "k", "v", "--lease=0"}) {
+		t.Errorf("no lease: %v", got)
+	}
+
+	// newest wins, hex like etcdctl
+	etcd.leases = []clientv3.LeaseID{1, 0x694d81417b5a2e05}
+	got = etcd.repairLease(line)
+
+	if !reflect.DeepEqual(got, []string{"put", "k", "v", "--lease=694d81417b5a2e05"}) {
+		t.Errorf("lease: %v", got)
+	}
+
+	// template untouched for the crash file
+	if line[3] != "--lease="+EtcdLease {
+		t.Errorf("template changed: %v", line)
+	}
+
+	_, err := ParseEtcdLine(got)
+
+	if err != nil {
+		t.Errorf("repaired line: %v", err)
+	}
+}
+
+func TestEtcdShutDownDir(t *testing.T) {
+
+	etcd := NewEtcd(utils.TargetFeature{utils.TARGET_PATH: "/bin/sh", utils.TARGET_PORT: "1"})
+
+	_, err := os.Stat(etcd.dir)
+
+	if err != nil {
+		t.Fatalf("data dir: %v", err)
+	}
+
+	// never started, dir must go anyway
+	etcd.ShutDown()
+
+	_, err = os.Stat(etcd.dir)
+
+	if !os.IsNotExist(err) {
+		t.Errorf("data dir %s left, %v", etcd.dir, err)
+	}
+}
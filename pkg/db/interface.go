@@ -14,5 +14,55 @@ type DB interface {
 	Execute([]string) (utils.TargetState, error)
 	Collect() (model.Snapshot, error)
 	Stderr() string
+	Name() string
+	LineSep() string
+	TokenSep() string
 	Debug()
 }
+
+// public
+func NewDB(target utils.TargetType, feature utils.TargetFeature) DB {
+
+	feature[utils.TARGET_NAME] = target.String()
+	feature[utils.TARGET_KIND] = target.Kind().String()
+
+	switch target.Kind() {
+	// Redi
+	case utils.REDI_REDIS, utils.REDI_KEYDB, utils.REDI_STACK, utils.REDI_VALKEY:
+		return NewRedi(feature)
+	case utils.REDI_CLUSTER:
+		return NewCluster(feature)
+	// KV
+	case utils.KV_ETCD:
+		return NewEtcd(feature)
+	}
+
+	return nil
+}
+
+// public
+// master/replica pair, redi only
+func NewReplDB(target utils.TargetType, feature utils.TargetFeature) DB {
+
+	feature[utils.TARGET_NAME] = target.String()
+	feature[utils.TARGET_KIND] = target.Kind().String()
+
+	switch target.Kind() {
+	case utils.REDI_REDIS, utils.REDI_KEYDB, utils.REDI_STACK, utils.REDI_VALKEY:
+		return NewRepl(feature)
+	}
+
+	return nil
+}
+
+// raw protocol
+type RawExecutor interface {
+	DB
+	ExecuteRaw([][]byte) (utils.TargetState, error)
+}
+
+// target process, e.g. rss
+type Processor interface {
+	DB
+	Pid() int
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+// persistence round trip
+type Persister interface {
+	DB
+	Digest() (*Digest, error)
+	Reload(aof bool) (utils.CrashJson, utils.TargetState, error)
+}
+
+// DEBUG DIGEST, per key TYPE:DIGEST-VALUE
+type Digest struct {
+	All      string
+	Keys     map[string]string
+	// keys with ttl are skipped, they may expire on reload
+	Volatile bool
+}
+
+// redis 7 disables DEBUG by default
+const (
+	RediDebugArg string = "--enable-debug-command" + " " + "local"
+)
+
+// aof rewrite polling
+const (
+	RediRewritePoll time.Duration = 10 * time.Millisecond
+)
+
+/*
+ * Redi Persist Functions
+ */
+
+// public
+func (self *Redi) Digest() (*Digest, error) {
+
+	ctx, cancel := context.WithTimeout(self.ctx, RediExecTimeout)
+	defer cancel()
+
+	all, err := self.client.Do(ctx, "DEBUG", "DIGEST").Text()
+
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{
+		All:  all,
+		Keys: make(map[string]string, 0),
+	}
+
+	keys, err := self.client.Keys(ctx, "*").Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+
+		ttl, err := self.client.PTTL(ctx, key).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// -1 no ttl, -2 gone
+		if ttl != -1 {
+			digest.Volatile = true
+			continue
+		}
+
+		keyType, err := self.client.Type(ctx, key).Result()
+
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := self.client.Do(ctx, "DEBUG", "DIGEST-VALUE", key).StringSlice()
+
+		if err != nil || len(values) == 0 {
+			return nil, errors.New("DEBUG DIGEST-VALUE failed.")
+		}
+
+		digest.Keys[key] = keyType + ":" + values[0]
+	}
+
+	return digest, nil
+}
+
+// public
+// SAVE + DEBUG RELOAD, or BGREWRITEAOF + DEBUG LOADAOF
+// returns the lines sent, analyze replays them
+func (self *Redi) Reload(aof bool) (utils.CrashJson, utils.TargetState, error) {
+
+	sent := make(utils.CrashJson, 0)
+
+	// rdb
+	if !aof {
+
+		for _, step := range [][]string{{"SAVE"}, {"DEBUG", "RELOAD"}} {
+
+			sent = append(sent, step)
+			_, state, err := self.ExecuteReply(step)
+
+			if state != utils.STATE_OK {
+				return sent, state, err
+			}
+		}
+
+		return sent, utils.STATE_OK, nil
+	}
+
+	ctx, cancel := context.WithTimeout(self.ctx, RediExecTimeout)
+	defer cancel()
+
+	config, err := self.client.ConfigGet(ctx, "appendonly").Result()
+
+	if err != nil {
+		return sent, self.failState(), err
+	}
+
+	prev := config["appendonly"]
+
+	// already on
+	if prev == "yes" {
+		return self.loadAof(sent)
+	}
+
+	// aof on, first rewrite may be scheduled
+	step := []string{"CONFIG", "SET", "appendonly", "yes"}
+	sent = append(sent, step)
+	_, state, err := self.ExecuteReply(step)
+
+	if state != utils.STATE_OK {
+		return sent, state, err
+	}
+
+	sent, state, err = self.loadAof(sent)
+
+	// target is gone
+	if state == utils.STATE_CRASH || state == utils.STATE_HANG {
+		return sent, state, err
+	}
+
+	// back to previous
+	step = []string{"CONFIG", "SET", "appendonly", prev}
+	sent = append(sent, step)
+	_, restored, restoreErr := self.ExecuteReply(step)
+
+	if state == utils.STATE_OK {
+		return sent, restored, restoreErr
+	}
+
+	return sent, state, err
+}
+
+// private
+// BGREWRITEAOF + DEBUG LOADAOF, aof is on
+func (self *Redi) loadAof(sent utils.CrashJson) (utils.CrashJson, utils.TargetState, error) {
+
+	err := self.waitRewrite()
+
+	if err != nil {
+		return sent, self.failState(), err
+	}
+
+	sent = append(sent, []string{"BGREWRITEAOF"})
+	_, state, err := self.ExecuteReply([]string{"BGREWRITEAOF"})
+
+	if state != utils.STATE_OK {
+		return sent, state, err
+	}
+
+	err = self.waitRewrite()
+
+	if err != nil {
+		return sent, self.failState(), err
+	}
+
+	sent = append(sent, []string{"DEBUG", "LOADAOF"})
+	_, state, err = self.ExecuteReply([]string{"DEBUG", "LOADAOF"})
+
+	return sent, state, err
+}
+
+// private
+func (self *Redi) waitRewrite() error {
+
+	deadline := time.Now().Add(RediExecTimeout)
+
+	for time.Now().Before(deadline) {
+
+		info, err := self.client.Info(self.ctx, "persistence").Result()
+
+		if err != nil {
+			return err
+		}
+
+		// rewrite done
+		if strings.Contains(info, "aof_rewrite_in_progress:0") && strings.Contains(info, "aof_rewrite_scheduled:0") {
+			return nil
+		}
+
+		time.Sleep(RediRewritePoll)
+	}
+
+	return errors.New("aof rewrite timeout.")
+}
@@ -0,0 +1,32 @@
+package db
+
+// startup args, applied on next StartUp
+type Profiler interface {
+	DB
+	SetProfile([]string)
+}
+
+/*
+ * Profile Functions
+ */
+
+// public
+func (self *Redi) SetProfile(args []string) {
+
+	self.profile = args
+}
+
+// public
+func (self *Repl) SetProfile(args []string) {
+
+	self.master.SetProfile(args)
+	self.replica.SetProfile(args)
+}
+
+// public
+func (self *Cluster) SetProfile(args []string) {
+
+	for _, node := range self.nodes {
+		node.SetProfile(args)
+	}
+}
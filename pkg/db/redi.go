@@ -6,8 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/fuxxcss/redi2fuzz/pkg/utils"
 	"github.com/fuxxcss/redi2fuzz/pkg/model"
@@ -22,14 +28,28 @@ import (
 type Redi struct {
 
 	// proc ...
+	name string
 	path string
 	args []string
+	// working dir, rdb, aof and nodes.conf of this port
+	dir  string
+	// startup profile, see SetProfile
+	profile []string
+	env  []string
 	stderr bytes.Buffer
 	proc *exec.Cmd
+	done chan struct{}
+	// readiness timeout
+	ready time.Duration
+	// running pid, read by metrics
+	pid  atomic.Int64
 
 	// runtime ...
+	addr   string
 	client *redis.Client
 	ctx    context.Context
+	// named sequence connections, 0 is main, see conn
+	conns  []*rediConn
 }
 
 const (
@@ -37,6 +57,46 @@ const (
 	RediTokenSep string = " "
 )
 
+// waiting crash report, waiting first PING
+// one working dir per instance, under the fuzzer dir
+const (
+	RediWorkPath string = "work"
+)
+
+const (
+	RediExitTimeout  time.Duration = 10 * time.Second
+	RediReadyTimeout time.Duration = 30 * time.Second
+)
+
+// command deadline, PING from another connection
+const (
+	RediExecTimeout time.Duration = 5 * time.Second
+	RediPingTimeout time.Duration = time.Second
+)
+
+// TYPE of module keys, query engine index
+const (
+	RediTypeTS     string = "TSDB-TYPE"
+	RediTypeTopK   string = "TopK-TYPE"
+	RediTypeIndex  string = "ft-index"
+	RediTypeBloom  string = "MBbloom--"
+	RediTypeCuckoo string = "MBbloomCF"
+	RediTypeCMS    string = "CMSk-TYPE"
+)
+
+// INFO fields of probabilistic keys that RESERVE, INITBYDIM ... take
+var rediInfoFields = map[string][]string{
+	RediTypeBloom:  {"Capacity", "Expansion rate"},
+	RediTypeCuckoo: {"Bucket size", "Expansion rate", "Max iterations"},
+	RediTypeCMS:    {"width", "depth"},
+}
+
+// raw protocol
+const (
+	RediRawTimeout time.Duration = 500 * time.Millisecond
+	RediRawGap     time.Duration = time.Millisecond
+)
+
 
 /*
  * Redi Functions
@@ -44,10 +104,6 @@ const (
 
 func NewRedi(feature utils.TargetFeature) *Redi {
 
-	// set global sep
-	model.LineSep = RediLineSep
-	model.TokenSep = RediTokenSep
-
 	redi := new(Redi)
 
 	// path, port
@@ -63,13 +119,45 @@ func NewRedi(feature utils.TargetFeature) *Redi {
 		log.Fatalf("err: %s %v", path, err)
 	}
 
-	redi.path = path
-	
+	// proc runs in dir
+	redi.path, err = filepath.Abs(path)
+
+	if err != nil {
+		log.Fatalf("err: %s %v", path, err)
+	}
+
+	redi.dir, err = filepath.Abs(filepath.Join(RediWorkPath, "redi-"+port))
+
+	if err != nil {
+		log.Fatalf("err: %s %v", RediWorkPath, err)
+	}
+
+	redi.name = feature[utils.TARGET_NAME]
+	redi.ready = feature.Ready(RediReadyTimeout)
+
+	// e.g. ASAN_OPTIONS
+	redi.env = feature.Env()
+
+	// afl coverage map
+	id, ok := feature[utils.COVERAGE_ID]
+
+	if ok {
+		redi.env = append(redi.env,
+			utils.CoverageEnv + "=" + id,
+			utils.AflShmEnv + "=" + id,
+		)
+	}
+
+	redi.addr = "localhost:" + port
+
 	// redi runtime
 	redi.client = redis.NewClient(&redis.Options{
-		Addr:     "localhost:" + port,
+		Addr:     redi.addr,
 		Password: "",
 		DB:       0,
+		// blocking commands obey context deadline
+		ReadTimeout:           RediExecTimeout,
+		ContextTimeoutEnabled: true,
 	})
 
 	redi.ctx = context.Background()
@@ -82,12 +170,25 @@ func NewRedi(feature utils.TargetFeature) *Redi {
 		redi.client.Do(redi.ctx,"shutdown")
 	}
 
-	// redi args
+	// redi args, one argv element each
 	redi.args = []string{
 		// port
-		"--port" + " " + port,
+		"--port", port,
+		// one rdb per instance
+		"--dbfilename", "dump-" + port + ".rdb",
+	}
+
+	// one aof per instance, keydb 6 has no appenddirname
+	if feature[utils.TARGET_KIND] == utils.REDI_KEYDB.String() {
+		redi.args = append(redi.args, "--appendfilename", "appendonly-"+port+".aof")
+	} else {
+		redi.args = append(redi.args, "--appenddirname", "appendonlydir-"+port)
 	}
 
+	// extra args
+	redi.args = append(redi.args, strings.Fields(feature[utils.TARGET_ARGS])...)
+	redi.profile = strings.Fields(feature[utils.TARGET_PROFILE])
+
 	return redi
 
 }
@@ -100,24 +201,66 @@ func NewRedi(feature utils.TargetFeature) *Redi {
 // public
 func (self *Redi) StartUp() error {
 
-	self.proc = exec.Command(self.path, self.args...)
+	self.stderr.Reset()
+	self.closeConns()
+
+	args := append(slices.Clone(self.args), self.profile...)
+
+	// other workers, replica and cluster nodes keep their files
+	err := os.MkdirAll(self.dir, 0775)
+
+	if err != nil {
+		return err
+	}
+
+	self.proc = exec.Command(self.path, args...)
+	self.proc.Dir = self.dir
+	self.proc.Env = append(os.Environ(), self.env...)
+	// without logfile the log, bug report and asserts go to stdout
+	self.proc.Stdout = &self.stderr
 	self.proc.Stderr = &self.stderr
 
 	// error
-	err := self.proc.Start()
+	err = self.proc.Start()
 
 	// startup failed
 	if err != nil {
 		return err
 	}
 
+	// reap redi
+	self.done = make(chan struct{})
+
+	pid := int64(self.proc.Process.Pid)
+	self.pid.Store(pid)
+
+	go func(proc *exec.Cmd, done chan struct{}) {
+		proc.Wait()
+		self.pid.CompareAndSwap(pid, 0)
+		close(done)
+	}(self.proc, self.done)
+
 	// waiting redi startup
 	fmt.Println("[*] waiting redi startup...")
+	deadline := time.Now().Add(self.ready)
+
 	for {
 		alive := self.CheckAlive()
 		if alive {
 			break
 		}
+
+		// exit early
+		select {
+		case <-self.done:
+			return errors.New("redi exit on startup.")
+		default:
+		}
+
+		if time.Now().After(deadline) {
+			self.ShutDown()
+			return fmt.Errorf("redi not ready after %v.", self.ready)
+		}
 	}
 
 	// succeed
@@ -129,41 +272,35 @@ func (self *Redi) StartUp() error {
 // public
 func (self *Redi) Restart() error {
 
-	err := self.proc.Start()
-
-	// restart failed
-	if err != nil {
-		return err
-	}
+	// old redi may be alive
+	self.ShutDown()
 
-	// waiting redi restart
 	fmt.Println("[*] waiting redi restart...")
-	for {
-		alive := self.CheckAlive()
-		if alive {
-			break
-		}
-	}
 
-	// db succeed
-	fmt.Printf("[*] Redi %v ReStart.\n", self.path)
-
-	return nil
+	return self.StartUp()
 }
 
 // public
 func (self *Redi) ShutDown() {
 
+	if self.proc == nil || self.proc.Process == nil {
+		return
+	}
+
 	// kill redi
 	self.proc.Process.Kill()
+	<-self.done
 
 }
 
 // public
 func (self *Redi) CheckAlive() bool {
 
+	ctx, cancel := context.WithTimeout(self.ctx, RediPingTimeout)
+	defer cancel()
+
 	// redi state
-	_, err := self.client.Ping(self.ctx).Result()
+	_, err := self.client.Ping(ctx).Result()
 
 	// redi is not alive
 	if err != nil {
@@ -174,8 +311,17 @@ func (self *Redi) CheckAlive() bool {
 }
 
 // public
+// MULTI, WATCH, blocked and client state are dropped with the connections
 func (self *Redi) CleanUp() error {
 
+	self.closeConns()
+
+	// CLIENT PAUSE of last sequence, would block the flushes
+	self.client.Do(self.ctx, "CLIENT", "UNPAUSE")
+
+	// libraries survive FLUSHALL, keydb has none
+	self.client.FunctionFlush(self.ctx)
+
 	_, err := self.client.FlushAll(self.ctx).Result()
 
 	// flushall failed
@@ -189,6 +335,16 @@ func (self *Redi) CleanUp() error {
 // public
 func (self *Redi) Execute(tokens []string) (utils.TargetState, error) {
 
+	_, state, err := self.ExecuteReply(tokens)
+
+	return state, err
+
+}
+
+// public
+// reply is normalized, see NormalizeReply
+func (self *Redi) ExecuteReply(tokens []string) (string, utils.TargetState, error) {
+
 	// marshal string
 	args := []interface{}{}
 
@@ -199,23 +355,98 @@ func (self *Redi) Execute(tokens []string) (utils.TargetState, error) {
 	// state
 	state := utils.STATE_OK
 
-	_, err := self.client.Do(self.ctx, args...).Result()
+	ctx, cancel := context.WithTimeout(self.ctx, RediExecTimeout)
+	defer cancel()
+
+	reply, err := self.conn(0).client.Do(ctx, args...).Result()
 
 	// execute failed
 	if err != nil && err != redis.Nil {
+		state = self.failState()
 
-		// execute error
-		if self.CheckAlive() {
-			state = utils.STATE_ERR
+		return ErrorClass(err), state, err
+	}
 
-		// crash
-		} else {
-			state = utils.STATE_CRASH
+	// empty line has no cmd
+	cmd := ""
+
+	if len(tokens) > 0 {
+		cmd = tokens[0]
+	}
+
+	return NormalizeReply(cmd, reply), state, err
+
+}
+
+// public
+// write packets on a fresh conn, bypass go-redis
+func (self *Redi) ExecuteRaw(packets [][]byte) (utils.TargetState, error) {
+
+	conn, err := net.DialTimeout("tcp", self.addr, RediRawTimeout)
+
+	// cannot connect
+	if err != nil {
+		return self.failState(), err
+	}
+
+	defer conn.Close()
+
+	for i, packet := range packets {
+
+		// split packets
+		if i > 0 {
+			time.Sleep(RediRawGap)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(RediRawTimeout))
+		_, err = conn.Write(packet)
+
+		// server closed conn
+		if err != nil {
+			return self.failState(), err
 		}
 	}
 
-	return state, err
+	// first reply only
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(RediRawTimeout))
+	n, err := conn.Read(buf)
+
+	// waiting more bytes, e.g. oversized bulk
+	if err != nil {
+
+		netErr, ok := err.(net.Error)
+
+		if ok && netErr.Timeout() {
+			return utils.STATE_OK, nil
+		}
+
+		return self.failState(), err
+	}
+
+	// -ERR ...
+	if n > 0 && buf[0] == '-' {
+		return utils.STATE_ERR, errors.New(string(bytes.TrimSpace(buf[:n])))
+	}
+
+	return utils.STATE_OK, nil
+}
+
+// private
+// answers PING: error, exits: crash, still running: hang
+func (self *Redi) failState() utils.TargetState {
+
+	if self.CheckAlive() {
+		return utils.STATE_ERR
+	}
 
+	// crash report may take a while
+	select {
+	case <-self.done:
+		return utils.STATE_CRASH
+	case <-time.After(RediExitTimeout):
+		return utils.STATE_HANG
+	}
 }
 
 // public
@@ -226,13 +457,6 @@ func (self *Redi) Collect() (model.Snapshot, error) {
 
 	keys, _ := self.client.Keys(self.ctx, "*").Result()
 
-	// redis stack query engine, type = "none"
-	ft, err := self.client.Do(self.ctx, "FT._LIST").Text()
-
-	if err == nil {
-		keys = append(keys, ft)
-	}
-
 	// keys
 	for _, key := range keys {
 
@@ -243,13 +467,18 @@ func (self *Redi) Collect() (model.Snapshot, error) {
 			return nil, errors.New("TYPE key failed.")
 		}
 
-		// special key
+		// special key, geo is a zset
 		fmap := map[string]func(string, *model.Snapshot) error{
-			"hash": self.collectHash,
-			// "geo" : collect geo,
-			"stream": self.collectStream,
-			// "none" : collect ft,
-			// "TSDB-TYPE" : collect ts,
+			"hash":      self.collectHash,
+			"set":       self.collectSet,
+			"zset":      self.collectZset,
+			"list":      self.collectList,
+			"stream":    self.collectStream,
+			RediTypeTS:     self.collectTS,
+			RediTypeTopK:   self.collectTopK,
+			RediTypeBloom:  self.collectBloom,
+			RediTypeCuckoo: self.collectCuckoo,
+			RediTypeCMS:    self.collectCMS,
 		}
 
 		f, ok := fmap[keyType]
@@ -262,40 +491,41 @@ func (self *Redi) Collect() (model.Snapshot, error) {
 			if err != nil {
 				return nil, err
 			}
-		
+
 		// common key
-		}else {
+		} else {
+			collectMembers(key, keyType, nil, &snapshot)
+		}
 
-			keyToken := model.Token{
-				Level : model.TOKEN_LEVEL_1,
-				Text : key,
-			}
+	}
+
+	// redis stack query engine, not in keyspace
+	indexes, err := self.client.Do(self.ctx, "FT._LIST").StringSlice()
+
+	if err == nil {
+
+		for _, index := range indexes {
 
-			_, ok := snapshot[keyToken]
+			err := self.collectFT(index, &snapshot)
 
-			if !ok {
-				snapshot[keyToken] = make([]model.Token, 0)
+			// failed
+			if err != nil {
+				return nil, err
 			}
 		}
-
 	}
 
 	return snapshot, nil
 }
 
 // private
-func (self *Redi) collectHash(key string, snapshot *model.Snapshot) error {
-
-	fields, err := self.client.HKeys(self.ctx, key).Result()
-
-	// HKEYS failed
-	if err != nil {
-		return errors.New("collect hash failed.")
-	}
+// key (level 1) ---> members (level 2), both typed
+func collectMembers(key, keyType string, members []string, snapshot *model.Snapshot) {
 
 	keyToken := model.Token{
 		Level : model.TOKEN_LEVEL_1,
 		Text : key,
+		Type : keyType,
 	}
 
 	_, ok := (*snapshot)[keyToken]
@@ -304,18 +534,80 @@ func (self *Redi) collectHash(key string, snapshot *model.Snapshot) error {
 		(*snapshot)[keyToken] = make([]model.Token, 0)
 	}
 
-	for _, field := range fields {
+	for _, member := range members {
 
-		fieldToken := model.Token{
+		memberToken := model.Token{
 			Level : model.TOKEN_LEVEL_2,
-			Text : field,
+			Text : member,
+			Type : keyType,
 		}
 
-		(*snapshot)[keyToken] =append((*snapshot)[keyToken], fieldToken)
+		(*snapshot)[keyToken] = append((*snapshot)[keyToken], memberToken)
 	}
+}
+
+// private
+func (self *Redi) collectHash(key string, snapshot *model.Snapshot) error {
+
+	fields, err := self.client.HKeys(self.ctx, key).Result()
+
+	// HKEYS failed
+	if err != nil {
+		return errors.New("collect hash failed.")
+	}
+
+	collectMembers(key, "hash", fields, snapshot)
+
+	return nil
+
+}
+
+// private
+func (self *Redi) collectSet(key string, snapshot *model.Snapshot) error {
+
+	members, err := self.client.SMembers(self.ctx, key).Result()
+
+	// SMEMBERS failed
+	if err != nil {
+		return errors.New("collect set failed.")
+	}
+
+	collectMembers(key, "set", members, snapshot)
+
+	return nil
+}
+
+// private
+// zset and geo members
+func (self *Redi) collectZset(key string, snapshot *model.Snapshot) error {
+
+	members, err := self.client.ZRange(self.ctx, key, 0, -1).Result()
+
+	// ZRANGE failed
+	if err != nil {
+		return errors.New("collect zset failed.")
+	}
+
+	collectMembers(key, "zset", members, snapshot)
 
 	return nil
+}
+
+// private
+func (self *Redi) collectList(key string, snapshot *model.Snapshot) error {
+
+	elements, err := self.client.LRange(self.ctx, key, 0, -1).Result()
+
+	// LRANGE failed
+	if err != nil {
+		return errors.New("collect list failed.")
+	}
 
+	// same element once
+	slices.Sort(elements)
+	collectMembers(key, "list", slices.Compact(elements), snapshot)
+
+	return nil
 }
 
 // private
@@ -327,45 +619,208 @@ func (self *Redi) collectStream(key string, snapshot *model.Snapshot) error {
 		return errors.New("collect stream failed.")
 	}
 
-	keyToken := model.Token{
-		Level : model.TOKEN_LEVEL_1,
-		Text : key,
+	fields := make([]string, 0)
+
+	for _, entry := range entries {
+
+		for field := range entry.Values {
+			fields = append(fields, field)
+		}
 	}
 
-	_, ok := (*snapshot)[keyToken]
+	collectMembers(key, "stream", fields, snapshot)
 
-	if !ok {
-		(*snapshot)[keyToken] = make([]model.Token, 0)
+	return nil
+}
+
+// private
+// key (level 1) ---> label, rule dest (level 2)
+// label (level 2) ---> label value (level 3)
+func (self *Redi) collectTS(key string, snapshot *model.Snapshot) error {
+
+	info, err := self.client.Do(self.ctx, "TS.INFO", key).Result()
+
+	// TS.INFO failed
+	if err != nil {
+		return errors.New("collect timeseries failed.")
 	}
 
-	for _, entry := range entries {
+	fields := replyMap(info)
+	members := make([]string, 0)
 
-		for field := range entry.Values {
+	for _, label := range replyPairs(fields["labels"]) {
 
-			fieldToken := model.Token{
-				Level : model.TOKEN_LEVEL_2,
-				Text : field,
-			}
-	
-			(*snapshot)[keyToken] =append((*snapshot)[keyToken], fieldToken)
+		name := replyString(label[0])
+		members = append(members, name)
+
+		labelToken := model.Token{
+			Level : model.TOKEN_LEVEL_2,
+			Text : name,
+			Type : RediTypeTS,
+		}
+
+		valueToken := model.Token{
+			Level : model.TOKEN_LEVEL_3,
+			Text : replyString(label[1]),
+			Type : RediTypeTS,
 		}
+
+		(*snapshot)[labelToken] = append((*snapshot)[labelToken], valueToken)
+	}
+
+	// compaction rules
+	for _, rule := range replyPairs(fields["rules"]) {
+		members = append(members, replyString(rule[0]))
 	}
 
+	collectMembers(key, RediTypeTS, members, snapshot)
+
+	return nil
+}
+
+// private
+func (self *Redi) collectTopK(key string, snapshot *model.Snapshot) error {
+
+	items, err := self.client.Do(self.ctx, "TOPK.LIST", key).StringSlice()
+
+	// TOPK.LIST failed
+	if err != nil {
+		return errors.New("collect topk failed.")
+	}
+
+	collectMembers(key, RediTypeTopK, items, snapshot)
+
+	return nil
+}
+
+// private
+// bloom, cuckoo, cms items cannot be listed, their sizes can
+func (self *Redi) collectInfo(key, keyType, cmd string, snapshot *model.Snapshot) error {
+
+	info, err := self.client.Do(self.ctx, cmd, key).Result()
+
+	// INFO failed
+	if err != nil {
+		return fmt.Errorf("collect %s failed.", keyType)
+	}
+
+	fields := replyMap(info)
+	members := make([]string, 0)
+
+	for _, name := range rediInfoFields[keyType] {
+
+		value, ok := fields[name]
+
+		if ok && !slices.Contains(members, replyString(value)) {
+			members = append(members, replyString(value))
+		}
+	}
+
+	collectMembers(key, keyType, members, snapshot)
+
+	return nil
+}
+
+// private
+func (self *Redi) collectBloom(key string, snapshot *model.Snapshot) error {
+
+	return self.collectInfo(key, RediTypeBloom, "BF.INFO", snapshot)
+}
+
+// private
+func (self *Redi) collectCuckoo(key string, snapshot *model.Snapshot) error {
+
+	return self.collectInfo(key, RediTypeCuckoo, "CF.INFO", snapshot)
+}
+
+// private
+func (self *Redi) collectCMS(key string, snapshot *model.Snapshot) error {
+
+	return self.collectInfo(key, RediTypeCMS, "CMS.INFO", snapshot)
+}
+
+// private
+// index (level 1) ---> attribute (level 2)
+func (self *Redi) collectFT(index string, snapshot *model.Snapshot) error {
+
+	info, err := self.client.Do(self.ctx, "FT.INFO", index).Result()
+
+	// FT.INFO failed
+	if err != nil {
+		return errors.New("collect index failed.")
+	}
+
+	attributes, _ := replyMap(info)["attributes"].([]interface{})
+	names := make([]string, 0, len(attributes))
+
+	for _, attribute := range attributes {
+
+		fields := replyMap(attribute)
+
+		// alias first
+		name := replyString(fields["attribute"])
+
+		if name == "" {
+			name = replyString(fields["identifier"])
+		}
+
+		names = append(names, name)
+	}
+
+	collectMembers(index, RediTypeIndex, names, snapshot)
+
 	return nil
 }
 
 // public
 func (self *Redi) Stderr() string {
 
+	// crashed, wait for the whole report
+	if self.done != nil && !self.CheckAlive() {
+
+		select {
+		case <-self.done:
+		case <-time.After(RediExitTimeout):
+		}
+	}
+
 	return self.stderr.String()
 }
 
+// public
+// 0 if not running
+func (self *Redi) Pid() int {
+
+	return int(self.pid.Load())
+}
+
+// public
+func (self *Redi) Name() string {
+
+	return self.name
+}
+
+// public
+func (self *Redi) LineSep() string {
+
+	return RediLineSep
+}
+
+// public
+func (self *Redi) TokenSep() string {
+
+	return RediTokenSep
+}
+
 // public
 func (self *Redi) Debug() {
 
 	log.Println("==== Redi ====")
+	log.Printf("name: %s\n", self.name)
 	log.Printf("path: %s\n", self.path)
 	log.Printf("args: %v\n", self.args)
+	log.Printf("profile: %v\n", self.profile)
+	log.Printf("env: %v\n", self.env)
 }
 
 
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Repl Definition
+ */
+
+/*	Repl Struct	*/
+// master on port, replica on port+1
+type Repl struct {
+	master  *Redi
+	replica *Redi
+
+	// side died last, see Stderr
+	died    string
+}
+
+// replication sides
+const (
+	ReplMaster  string = "master"
+	ReplReplica string = "replica"
+)
+
+// replica link, WAIT and offset polling
+const (
+	ReplLinkTimeout time.Duration = 10 * time.Second
+	ReplSyncTimeout time.Duration = 5 * time.Second
+	ReplPoll        time.Duration = 10 * time.Millisecond
+	REPL_PORTS      int           = 2
+)
+
+// master and replica digests
+type Replicator interface {
+	DB
+	Sync() (utils.TargetState, error)
+	Digests() (*Digest, *Digest, error)
+}
+
+/*
+ * Repl Functions
+ */
+
+func NewRepl(feature utils.TargetFeature) *Repl {
+
+	repl := new(Repl)
+
+	port, err := strconv.Atoi(feature[utils.TARGET_PORT])
+
+	if err != nil {
+		log.Fatalf("err: port %s %v", feature[utils.TARGET_PORT], err)
+	}
+
+	repl.master = NewRedi(feature)
+
+	// replica on next port
+	replica := maps.Clone(feature)
+	replica[utils.TARGET_PORT] = strconv.Itoa(port + 1)
+	repl.replica = NewRedi(replica)
+
+	return repl
+}
+
+/*
+ * Repl Interface
+ */
+
+// public
+func (self *Repl) StartUp() error {
+
+	self.died = ""
+
+	err := self.master.StartUp()
+
+	if err != nil {
+		return err
+	}
+
+	err = self.replica.StartUp()
+
+	if err != nil {
+		return err
+	}
+
+	// follow master
+	host, port, _ := strings.Cut(self.master.addr, ":")
+	_, err = self.replica.client.Do(self.replica.ctx, "REPLICAOF", host, port).Result()
+
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(ReplLinkTimeout)
+
+	for time.Now().Before(deadline) {
+
+		info, err := self.replica.client.Info(self.replica.ctx, "replication").Result()
+
+		if err == nil && strings.Contains(info, "master_link_status:up") {
+			fmt.Println("[*] replica link up.")
+			return nil
+		}
+
+		time.Sleep(ReplPoll)
+	}
+
+	return errors.New("replica link timeout.")
+}
+
+// public
+func (self *Repl) Restart() error {
+
+	self.ShutDown()
+
+	fmt.Println("[*] waiting repl restart...")
+
+	return self.StartUp()
+}
+
+// public
+func (self *Repl) ShutDown() {
+
+	self.replica.ShutDown()
+	self.master.ShutDown()
+}
+
+// public
+func (self *Repl) CheckAlive() bool {
+
+	return self.master.CheckAlive() && self.replica.CheckAlive()
+}
+
+// public
+// flushall is replicated
+func (self *Repl) CleanUp() error {
+
+	return self.master.CleanUp()
+}
+
+// public
+// master only, replica crash counts too
+func (self *Repl) Execute(tokens []string) (utils.TargetState, error) {
+
+	return self.masterState(self.master.Execute(tokens))
+}
+
+// public
+func (self *Repl) ExecutePipeline(lines [][]string) (utils.TargetState, error) {
+
+	return self.masterState(self.master.ExecutePipeline(lines))
+}
+
+// public
+func (self *Repl) ExecuteClient(client int, tokens []string) (utils.TargetState, error) {
+
+	return self.masterState(self.master.ExecuteClient(client, tokens))
+}
+
+// private
+func (self *Repl) masterState(state utils.TargetState, err error) (utils.TargetState, error) {
+
+	switch state {
+
+	case utils.STATE_CRASH, utils.STATE_HANG:
+		self.died = ReplMaster
+		return state, err
+	}
+
+	return self.replicaState(state, err)
+}
+
+// private
+func (self *Repl) replicaState(state utils.TargetState, err error) (utils.TargetState, error) {
+
+	if self.replica.CheckAlive() {
+		return state, err
+	}
+
+	self.died = ReplReplica
+
+	return self.replica.failState(), errors.New("replica died.")
+}
+
+// public
+// WAIT first, offset polling if no ack
+func (self *Repl) Sync() (utils.TargetState, error) {
+
+	ctx, cancel := context.WithTimeout(self.master.ctx, ReplSyncTimeout)
+	defer cancel()
+
+	acks, err := self.master.client.Wait(ctx, 1, ReplSyncTimeout/2).Result()
+
+	if err == nil && acks >= 1 {
+		return utils.STATE_OK, nil
+	}
+
+	for ctx.Err() == nil {
+
+		master, err := replOffset(ctx, self.master, "master_repl_offset:")
+
+		if err != nil {
+			return self.failState(err)
+		}
+
+		replica, err := replOffset(ctx, self.replica, "slave_repl_offset:")
+
+		if err != nil {
+			return self.failState(err)
+		}
+
+		if replica >= master {
+			return utils.STATE_OK, nil
+		}
+
+		time.Sleep(ReplPoll)
+	}
+
+	return self.failState(errors.New("replica sync timeout."))
+}
+
+// private
+// which side died
+func (self *Repl) failState(err error) (utils.TargetState, error) {
+
+	if !self.master.CheckAlive() {
+		self.died = ReplMaster
+		return self.master.failState(), err
+	}
+
+	return self.replicaState(utils.STATE_ERR, err)
+}
+
+// private
+func replOffset(ctx context.Context, redi *Redi, field string) (int64, error) {
+
+	info, err := redi.client.Info(ctx, "replication").Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(info, "\r\n") {
+
+		value, ok := strings.CutPrefix(line, field)
+
+		if ok {
+			return strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("%s not found.", field)
+}
+
+// public
+func (self *Repl) Digests() (*Digest, *Digest, error) {
+
+	master, err := self.master.Digest()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replica, err := self.replica.Digest()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return master, replica, nil
+}
+
+// public
+func (self *Repl) Collect() (model.Snapshot, error) {
+
+	return self.master.Collect()
+}
+
+// public
+// stderr of the side died
+func (self *Repl) Stderr() string {
+
+	switch self.died {
+
+	case ReplReplica:
+		return "side: " + ReplReplica + "\n" + self.replica.Stderr()
+
+	case ReplMaster:
+		return "side: " + ReplMaster + "\n" + self.master.Stderr()
+	}
+
+	return self.master.Stderr()
+}
+
+// public
+func (self *Repl) Name() string {
+
+	return self.master.Name() + "-repl"
+}
+
+// public
+func (self *Repl) LineSep() string {
+
+	return RediLineSep
+}
+
+// public
+func (self *Repl) TokenSep() string {
+
+	return RediTokenSep
+}
+
+// public
+func (self *Repl) Pid() int {
+
+	return self.master.Pid()
+}
+
+// public
+func (self *Repl) Debug() {
+
+	log.Println("==== Repl ====")
+	self.master.Debug()
+	self.replica.Debug()
+}
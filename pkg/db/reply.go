@@ -0,0 +1,222 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+// differential
+type Differ interface {
+	DB
+	ExecuteReply([]string) (string, utils.TargetState, error)
+}
+
+// unordered by spec, top level array is sorted
+var unorderedReplies = map[string]bool{
+	"KEYS":     true,
+	"SMEMBERS": true,
+	"SINTER":   true,
+	"SUNION":   true,
+	"SDIFF":    true,
+	"HKEYS":    true,
+	"HVALS":    true,
+	"PUBSUB":   true,
+}
+
+// unordered field value pairs, sorted as pairs
+var unorderedPairs = map[string]bool{
+	"HGETALL": true,
+}
+
+// public
+// RESP2 and RESP3 replies in one form, maps sorted,
+// arrays only if unordered by spec, e.g. SMEMBERS
+func NormalizeReply(cmd string, reply interface{}) string {
+
+	cmd = strings.ToUpper(cmd)
+
+	array, ok := reply.([]interface{})
+
+	if !ok {
+		return normalizeReply(reply)
+	}
+
+	switch {
+
+	case unorderedReplies[cmd]:
+		items := make([]string, 0, len(array))
+
+		for _, item := range array {
+			items = append(items, normalizeReply(item))
+		}
+
+		slices.Sort(items)
+
+		return "[" + strings.Join(items, ",") + "]"
+
+	// RESP2 flat map
+	case unorderedPairs[cmd]:
+		items := make([]string, 0, len(array)/2)
+
+		for pair := range slices.Chunk(array, 2) {
+
+			item := normalizeReply(pair[0])
+
+			if len(pair) == 2 {
+				item += "," + normalizeReply(pair[1])
+			}
+
+			items = append(items, item)
+		}
+
+		slices.Sort(items)
+
+		return "[" + strings.Join(items, ",") + "]"
+	}
+
+	return normalizeReply(reply)
+}
+
+// private
+// arrays in order, maps sorted by pairs
+func normalizeReply(reply interface{}) string {
+
+	switch v := reply.(type) {
+
+	case nil:
+		return "(nil)"
+
+	case string:
+		return strconv.Quote(v)
+
+	case int64:
+		return strconv.FormatInt(v, 10)
+
+	case float64:
+		return strconv.Quote(strconv.FormatFloat(v, 'f', -1, 64))
+
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+
+	case []interface{}:
+		items := make([]string, 0, len(v))
+
+		for _, item := range v {
+			items = append(items, normalizeReply(item))
+		}
+
+		return "[" + strings.Join(items, ",") + "]"
+
+	// RESP3 map, flatten as RESP2, unordered
+	case map[interface{}]interface{}:
+		items := make([]string, 0, len(v))
+
+		for k, item := range v {
+			items = append(items, normalizeReply(k)+","+normalizeReply(item))
+		}
+
+		slices.Sort(items)
+
+		return "[" + strings.Join(items, ",") + "]"
+
+	case error:
+		return ErrorClass(v)
+	}
+
+	return fmt.Sprintf("%v", reply)
+}
+
+// public
+// WRONGTYPE, ERR ..., keep prefix only
+func ErrorClass(err error) string {
+
+	if err == nil {
+		return ""
+	}
+
+	class, _, _ := strings.Cut(err.Error(), " ")
+
+	return "-" + class
+}
+
+// private
+// RESP3 map or RESP2 flat array
+func replyMap(value interface{}) map[string]interface{} {
+
+	ret := make(map[string]interface{}, 0)
+
+	switch v := value.(type) {
+
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			ret[replyString(k)] = item
+		}
+
+	case []interface{}:
+		for pair := range slices.Chunk(v, 2) {
+
+			if len(pair) == 2 {
+				ret[replyString(pair[0])] = pair[1]
+			}
+		}
+	}
+
+	return ret
+}
+
+// private
+// RESP3 map, RESP2 [[k, v, ...], ...] or flat [k, v, ...]
+func replyPairs(value interface{}) [][2]interface{} {
+
+	ret := make([][2]interface{}, 0)
+
+	switch v := value.(type) {
+
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			ret = append(ret, [2]interface{}{k, item})
+		}
+
+	case []interface{}:
+		for i := 0; i < len(v); i++ {
+
+			// nested pair
+			pair, ok := v[i].([]interface{})
+
+			if ok {
+				switch {
+				case len(pair) == 1:
+					ret = append(ret, [2]interface{}{pair[0], nil})
+				case len(pair) > 1:
+					ret = append(ret, [2]interface{}{pair[0], pair[1]})
+				}
+				continue
+			}
+
+			// flat pair
+			if i+1 < len(v) {
+				ret = append(ret, [2]interface{}{v[i], v[i+1]})
+				i++
+			}
+		}
+	}
+
+	return ret
+}
+
+// private
+func replyString(value interface{}) string {
+
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", value)
+}
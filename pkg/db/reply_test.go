@@ -0,0 +1,52 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeReply(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		cmd   string
+		reply interface{}
+		want  string
+	}{
+		{"nil", "GET", nil, "(nil)"},
+		{"string", "GET", "a b", `"a b"`},
+		{"int", "INCR", int64(-3), "-3"},
+		{"double", "ZSCORE", 1.5, `"1.5"`},
+		{"bool", "SISMEMBER", true, "1"},
+		{"error class", "GET", errors.New("WRONGTYPE Operation against a key"), "-WRONGTYPE"},
+		// ordered by spec, ordering bugs must diverge
+		{"lrange in order", "LRANGE", []interface{}{"b", "a"}, `["b","a"]`},
+		{"zrange in order", "zrange", []interface{}{"z", "a"}, `["z","a"]`},
+		{"nested in order", "SMEMBERS", []interface{}{[]interface{}{"b", "a"}}, `[["b","a"]]`},
+		// unordered by spec
+		{"smembers sorted", "smembers", []interface{}{"b", "a"}, `["a","b"]`},
+		{"keys sorted", "KEYS", []interface{}{"k2", "k1"}, `["k1","k2"]`},
+		{"hgetall pairs", "HGETALL", []interface{}{"f2", "v2", "f1", "v1"}, `["f1","v1","f2","v2"]`},
+		{"resp3 map", "HGETALL", map[interface{}]interface{}{"f2": "v2", "f1": "v1"}, `["f1","v1","f2","v2"]`},
+	}
+
+	for _, tt := range tests {
+
+		got := NormalizeReply(tt.cmd, tt.reply)
+
+		if got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeReplyPairs(t *testing.T) {
+
+	// pairs keep field and value together
+	a := NormalizeReply("HGETALL", []interface{}{"f1", "v2", "f2", "v1"})
+	b := NormalizeReply("HGETALL", []interface{}{"f1", "v1", "f2", "v2"})
+
+	if a == b {
+		t.Errorf("swapped values normalize to %s", a)
+	}
+}
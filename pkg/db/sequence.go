@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// pipelined lines on the main connection
+type Pipeliner interface {
+	DB
+	ExecutePipeline([][]string) (utils.TargetState, error)
+}
+
+// lines on another connection, 0 is main
+type MultiClient interface {
+	DB
+	ExecuteClient(int, []string) (utils.TargetState, error)
+}
+
+// named connections, 0 is main
+const (
+	REDI_CLIENTS   int    = 4
+	RediClientName string = "r2f-"
+)
+
+// other clients may block, the sequence goes on after
+const (
+	RediBlockWait time.Duration = 100 * time.Millisecond
+)
+
+// one named connection, lines run in order
+type rediConn struct {
+	client *redis.Client
+	// closed when the last line returns
+	done chan struct{}
+	err  error
+}
+
+/*
+ * Sequence Functions
+ */
+
+// public
+// one pipeline or one line, see utils.LineGroup
+func ExecuteGroup(target DB, group [][]string) (utils.TargetState, error) {
+
+	opts, tokens := utils.DecodeLine(group[0])
+
+	pipeliner, ok := target.(Pipeliner)
+
+	if len(group) > 1 && ok {
+
+		lines := make([][]string, 0, len(group))
+
+		for _, line := range group {
+
+			_, tokens := utils.DecodeLine(line)
+			lines = append(lines, tokens)
+		}
+
+		return pipeliner.ExecutePipeline(lines)
+	}
+
+	// no pipeline, one by one
+	if len(group) > 1 {
+
+		var state utils.TargetState
+		var err error
+
+		for _, line := range group {
+
+			state, err = ExecuteGroup(target, [][]string{line})
+
+			if state == utils.STATE_CRASH || state == utils.STATE_HANG {
+				break
+			}
+		}
+
+		return state, err
+	}
+
+	multi, ok := target.(MultiClient)
+
+	if opts.Client != 0 && ok {
+		return multi.ExecuteClient(opts.Client, tokens)
+	}
+
+	return target.Execute(tokens)
+}
+
+/*
+ * Redi Sequence Functions
+ */
+
+// private
+// named connection, state lives until CleanUp
+func (self *Redi) conn(client int) *rediConn {
+
+	if self.conns == nil {
+		self.conns = make([]*rediConn, REDI_CLIENTS)
+	}
+
+	client %= len(self.conns)
+
+	if self.conns[client] == nil {
+
+		self.conns[client] = &rediConn{
+			client: redis.NewClient(&redis.Options{
+				Addr:       self.addr,
+				ClientName: RediClientName + strconv.Itoa(client),
+				PoolSize:   1,
+				// blocking commands obey context deadline
+				ReadTimeout:           RediExecTimeout,
+				ContextTimeoutEnabled: true,
+			}),
+		}
+	}
+
+	return self.conns[client]
+}
+
+// private
+// blocked lines return on close
+func (self *Redi) closeConns() {
+
+	for _, conn := range self.conns {
+
+		if conn == nil {
+			continue
+		}
+
+		conn.client.Close()
+
+		if conn.done != nil {
+
+			select {
+			case <-conn.done:
+			case <-time.After(RediPingTimeout):
+			}
+		}
+	}
+
+	self.conns = nil
+}
+
+// public
+func (self *Redi) ExecutePipeline(lines [][]string) (utils.TargetState, error) {
+
+	ctx, cancel := context.WithTimeout(self.ctx, RediExecTimeout)
+	defer cancel()
+
+	_, err := self.conn(0).client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+
+		for _, tokens := range lines {
+
+			// marshal string
+			args := []interface{}{}
+
+			for _, token := range tokens {
+				args = append(args, token)
+			}
+
+			pipe.Do(ctx, args...)
+		}
+
+		return nil
+	})
+
+	// first failed line
+	if err != nil && err != redis.Nil {
+		return self.failState(), err
+	}
+
+	return utils.STATE_OK, nil
+}
+
+// public
+// main is synchronous, other clients run in background
+// and count as ok while blocked, e.g. BLPOP
+func (self *Redi) ExecuteClient(client int, tokens []string) (utils.TargetState, error) {
+
+	client %= REDI_CLIENTS
+
+	if client == 0 {
+		return self.Execute(tokens)
+	}
+
+	conn := self.conn(client)
+
+	// last line of this client first
+	if conn.done != nil {
+
+		select {
+		case <-conn.done:
+		case <-time.After(RediExecTimeout):
+			return self.failState(), errors.New("client still blocked.")
+		}
+	}
+
+	// marshal string
+	args := []interface{}{}
+
+	for _, token := range tokens {
+		args = append(args, token)
+	}
+
+	done := make(chan struct{})
+	conn.done = done
+
+	go func() {
+
+		ctx, cancel := context.WithTimeout(self.ctx, RediExecTimeout)
+		defer cancel()
+
+		_, conn.err = conn.client.Do(ctx, args...).Result()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(RediBlockWait):
+		return utils.STATE_OK, nil
+	}
+
+	if conn.err != nil && conn.err != redis.Nil {
+		return self.failState(), conn.err
+	}
+
+	return utils.STATE_OK, nil
+}
@@ -0,0 +1,92 @@
+package fuzz
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * Bucket Definition
+ */
+
+// crash output
+const (
+	PocPath string = "poc"
+)
+
+// bucket files
+const (
+	BucketFirst    string = "first.json"
+	BucketSmallest string = "smallest.json"
+	BucketHits     string = "hits"
+	BucketStderr   string = "stderr"
+	BucketTarget   string = "target"
+)
+
+// workers share buckets
+var bucketMu sync.Mutex
+
+/*
+ * Bucket Functions
+ */
+
+// public
+// dir/<signature>/, keep first and smallest, return hits
+func SaveBucket(dir, sig, target string, data []byte, stderr string) (int, error) {
+
+	bucketMu.Lock()
+	defer bucketMu.Unlock()
+
+	bucket := filepath.Join(dir, sig)
+
+	err := os.MkdirAll(bucket, 0755)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// hit counter
+	hits := 0
+	content, err := os.ReadFile(filepath.Join(bucket, BucketHits))
+
+	if err == nil {
+		hits, _ = strconv.Atoi(strings.TrimSpace(string(content)))
+	}
+
+	hits++
+
+	err = os.WriteFile(filepath.Join(bucket, BucketHits), []byte(strconv.Itoa(hits)+"\n"), 0664)
+
+	if err != nil {
+		return hits, err
+	}
+
+	// first reproducer
+	first := filepath.Join(bucket, BucketFirst)
+	_, err = os.Stat(first)
+
+	if os.IsNotExist(err) {
+
+		err = os.WriteFile(first, data, 0664)
+
+		if err != nil {
+			return hits, err
+		}
+
+		os.WriteFile(filepath.Join(bucket, BucketStderr), []byte(stderr), 0664)
+		os.WriteFile(filepath.Join(bucket, BucketTarget), []byte(target+"\n"), 0664)
+	}
+
+	// smallest reproducer
+	smallest := filepath.Join(bucket, BucketSmallest)
+	info, err := os.Stat(smallest)
+
+	if err != nil || int64(len(data)) < info.Size() {
+		return hits, os.WriteFile(smallest, data, 0664)
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,54 @@
+package fuzz
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveBucket(t *testing.T) {
+
+	dir := t.TempDir()
+
+	saves := []struct {
+		data string
+		hits int
+	}{
+		{`[["SET","a","bb"]]`, 1},
+		{`[["SET","a","bbbb"]]`, 2},
+		{`[["SET","a"]]`, 3},
+	}
+
+	for _, save := range saves {
+
+		hits, err := SaveBucket(dir, "sig", "redis", []byte(save.data), "stderr")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hits != save.hits {
+			t.Errorf("hits %d, want %d", hits, save.hits)
+		}
+	}
+
+	files := map[string]string{
+		BucketFirst:    saves[0].data,
+		BucketSmallest: saves[2].data,
+		BucketHits:     "3\n",
+		BucketTarget:   "redis\n",
+	}
+
+	for name, want := range files {
+
+		got, err := os.ReadFile(filepath.Join(dir, "sig", name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != want {
+			t.Errorf("%s: %q, want %q", name, got, want)
+		}
+	}
+}
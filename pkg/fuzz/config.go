@@ -0,0 +1,230 @@
+package fuzz
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Config Definition
+ */
+
+// params per sequence
+const (
+	CONFIG_MAXPARAMS int = 3
+)
+
+// never set, files, listeners, auth, crash report, our own clients
+var configDeny = []string{
+	"dir",
+	"dbfilename",
+	"appendfilename",
+	"appenddirname",
+	"logfile",
+	"pidfile",
+	"port",
+	"bind",
+	"unixsocket",
+	"unixsocketperm",
+	"requirepass",
+	"masterauth",
+	"masteruser",
+	"aclfile",
+	"replicaof",
+	"slaveof",
+	"maxclients",
+	"timeout",
+	"crash-log-enabled",
+	"crash-memcheck-enabled",
+	"cluster-config-file",
+	"cluster-enabled",
+	// tiny limits drop the fuzzer's own connection
+	"proto-max-bulk-len",
+	"client-query-buffer-limit",
+	"maxmemory-clients",
+}
+
+// prefixes of denied params
+var configDenyPrefix = []string{
+	"tls-",
+	"cluster-",
+}
+
+// known enums
+var configEnums = map[string][]string{
+	"maxmemory-policy": {
+		"volatile-lru", "allkeys-lru", "volatile-lfu", "allkeys-lfu",
+		"volatile-random", "allkeys-random", "volatile-ttl", "noeviction",
+	},
+	"maxmemory":              {"0", "1", "1kb", "1mb", "100mb"},
+	"appendfsync":            {"always", "everysec", "no"},
+	"notify-keyspace-events": {"", "KEA", "Kx", "Ez", "KEAmnt"},
+	"list-max-listpack-size": {"-5", "-4", "-3", "-2", "-1", "0", "1", "2"},
+	"list-max-ziplist-size":  {"-5", "-4", "-3", "-2", "-1", "0", "1", "2"},
+	"client-output-buffer-limit": {
+		"normal 0 0 0 replica 1 1 0 pubsub 1 1 0",
+		"pubsub 32mb 8mb 60",
+	},
+	"save": {"", "1 1", "3600 1 300 100 60 10000"},
+}
+
+// values of integer params
+var configIntegers = []string{
+	"0", "1", "-1", "2", "128", "65535", "4294967295", "9223372036854775807",
+}
+
+// mutable param and its startup value
+type configParam struct {
+	name  string
+	value string
+}
+
+/*
+ * Config Functions
+ */
+
+// private
+// CONFIG GET *, keep what CONFIG SET accepts
+func loadConfig(configurer db.Configurer) ([]configParam, error) {
+
+	config, err := configurer.Config()
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]configParam, 0)
+
+	for _, name := range slices.Sorted(maps.Keys(config)) {
+
+		if configDenied(name) {
+			continue
+		}
+
+		// same value, immutable ones fail
+		state, _ := configurer.Execute([]string{"CONFIG", "SET", name, config[name]})
+
+		if state != utils.STATE_OK {
+			continue
+		}
+
+		params = append(params, configParam{name: name, value: config[name]})
+	}
+
+	fmt.Printf("[*] config: %d mutable params\n", len(params))
+
+	return params, nil
+}
+
+// private
+func configDenied(name string) bool {
+
+	if slices.Contains(configDeny, name) {
+		return true
+	}
+
+	for _, prefix := range configDenyPrefix {
+
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// private
+// enum, flipped yes/no, interesting integer, or empty
+func configValue(rng *utils.Rand, param configParam) string {
+
+	values, ok := configEnums[param.name]
+
+	if ok {
+		return values[rng.Int(len(values))]
+	}
+
+	switch param.value {
+	case "yes":
+		return "no"
+	case "no":
+		return "yes"
+	}
+
+	n, err := strconv.ParseInt(param.value, 10, 64)
+
+	if err != nil {
+		return ""
+	}
+
+	switch rng.Int(3) {
+
+	// half, double
+	case 0:
+		return strconv.FormatInt(n/2, 10)
+	case 1:
+		return strconv.FormatInt(n*2, 10)
+	}
+
+	return configIntegers[rng.Int(len(configIntegers))]
+}
+
+// private
+// CONFIG SET before the sequence, lines go to cj so analyze applies them too
+func (self *worker) configApply(cj utils.CrashJson) (utils.CrashJson, []configParam, bool) {
+
+	applied := make([]configParam, 0)
+
+	for n := self.rng.Int(CONFIG_MAXPARAMS) + 1; n > 0; n-- {
+
+		param := self.configs[self.rng.Int(len(self.configs))]
+		line := []string{"CONFIG", "SET", param.name, configValue(self.rng, param)}
+
+		state, _ := self.target.Execute(line)
+		self.stats.Execs.Add(1)
+
+		cj = append(cj, line)
+
+		switch state {
+
+		case utils.STATE_OK:
+			self.stats.Oks.Add(1)
+			applied = append(applied, param)
+
+		// bad value
+		case utils.STATE_ERR:
+			self.stats.AddError("CONFIG")
+
+		case utils.STATE_CRASH, utils.STATE_HANG:
+			self.fail(state, cj, len(cj)-1, HangUnresponsive)
+			return cj, applied, true
+		}
+	}
+
+	return cj, applied, false
+}
+
+// private
+// startup values back
+func (self *worker) configRestore(applied []configParam) {
+
+	if len(applied) == 0 || !self.target.CheckAlive() {
+		return
+	}
+
+	for _, param := range applied {
+		self.target.Execute([]string{"CONFIG", "SET", param.name, param.value})
+	}
+
+	// restore crashed, not a finding of this sequence
+	if !self.target.CheckAlive() {
+		log.Println("err: config restore failed.")
+		self.target.Restart()
+	}
+}
@@ -0,0 +1,244 @@
+package fuzz
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Coverage Definition
+ */
+
+// afl shared memory
+const (
+	COVERAGE_SIZE int = 1 << 16
+)
+
+/*	Coverage Struct	*/
+// one trace per worker
+type Coverage struct {
+
+	// shm ...
+	id      int
+	// created and not yet marked IPC_RMID
+	owned   bool
+	trace   []byte
+
+	// shared by workers
+	virgin  *Virgin
+}
+
+// edges ever seen
+type Virgin struct {
+	mu    sync.Mutex
+	bits  []byte
+	edges int
+}
+
+// afl count class
+var countClass [256]byte
+
+func init() {
+
+	for i := range countClass {
+
+		switch {
+		case i == 0:
+			countClass[i] = 0
+		case i <= 3:
+			countClass[i] = byte(1 << (i - 1))
+		case i <= 7:
+			countClass[i] = 8
+		case i <= 15:
+			countClass[i] = 16
+		case i <= 31:
+			countClass[i] = 32
+		case i <= 127:
+			countClass[i] = 64
+		default:
+			countClass[i] = 128
+		}
+	}
+}
+
+/*
+ * Coverage Functions
+ */
+
+// public
+func NewVirgin() (*Virgin, error) {
+
+	size, err := mapSize()
+
+	if err != nil {
+		return nil, err
+	}
+
+	virgin := new(Virgin)
+	virgin.bits = make([]byte, size)
+
+	return virgin, nil
+}
+
+// public
+// attach COVERAGE_MAP if set, only one worker may attach
+func NewCoverage(virgin *Virgin, attach bool) (*Coverage, error) {
+
+	cov := new(Coverage)
+	size := len(virgin.bits)
+
+	// attach existing map
+	idStr, ok := os.LookupEnv(utils.CoverageEnv)
+
+	if ok && attach {
+		id, err := strconv.Atoi(idStr)
+
+		if err != nil {
+			return nil, errors.New("COVERAGE_MAP invalid.")
+		}
+
+		cov.id = id
+
+	// create new map
+	} else {
+		id, err := unix.SysvShmGet(unix.IPC_PRIVATE, size, unix.IPC_CREAT|unix.IPC_EXCL|0600)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cov.id = id
+		cov.owned = true
+	}
+
+	trace, err := unix.SysvShmAttach(cov.id, 0, 0)
+
+	// attach failed
+	if err != nil {
+		cov.Close()
+		return nil, err
+	}
+
+	cov.trace = trace
+	cov.virgin = virgin
+
+	// removed on last detach like afl, targets still attach by id on linux
+	if cov.owned {
+		unix.SysvShmCtl(cov.id, unix.IPC_RMID, nil)
+		cov.owned = false
+	}
+
+	// map size mismatch
+	if len(trace) < size {
+		cov.Close()
+		return nil, errors.New("coverage map too small.")
+	}
+
+	cov.trace = trace[:size]
+
+	return cov, nil
+}
+
+// private
+func mapSize() (int, error) {
+
+	sizeStr, ok := os.LookupEnv("AFL_MAP_SIZE")
+
+	if !ok {
+		return COVERAGE_SIZE, nil
+	}
+
+	size, err := strconv.Atoi(sizeStr)
+
+	if err != nil || size <= 0 {
+		return 0, errors.New("AFL_MAP_SIZE invalid.")
+	}
+
+	return size, nil
+}
+
+// public
+func (self *Coverage) Id() int {
+
+	return self.id
+}
+
+// public
+func (self *Coverage) Reset() {
+
+	clear(self.trace)
+}
+
+// public
+// merge trace into virgin, report new edges
+func (self *Coverage) HasNewBits() bool {
+
+	return self.virgin.merge(self.trace)
+}
+
+// public
+func (self *Coverage) Edges() int {
+
+	return self.virgin.Edges()
+}
+
+// public
+func (self *Virgin) Edges() int {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.edges
+}
+
+// private
+func (self *Virgin) merge(trace []byte) bool {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	found := false
+
+	for i, b := range trace {
+
+		// skip untouched
+		if b == 0 {
+			continue
+		}
+
+		class := countClass[b]
+
+		// new edge or new hit count
+		if class&^self.bits[i] != 0 {
+
+			if self.bits[i] == 0 {
+				self.edges++
+			}
+
+			self.bits[i] |= class
+			found = true
+		}
+	}
+
+	return found
+}
+
+// public
+func (self *Coverage) Close() {
+
+	if self.trace != nil {
+		unix.SysvShmDetach(self.trace)
+		self.trace = nil
+	}
+
+	// created map, attach failed
+	if self.owned {
+		unix.SysvShmCtl(self.id, unix.IPC_RMID, nil)
+	}
+}
@@ -0,0 +1,294 @@
+package fuzz
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Diff Definition
+ */
+
+// divergence output
+const (
+	DivergencePath string = "divergences"
+)
+
+// replies differ between dbms by design
+var diffSkip = map[string]bool{
+	"RANDOMKEY":   true,
+	"SPOP":        true,
+	"SRANDMEMBER": true,
+	"HRANDFIELD":  true,
+	"ZRANDMEMBER": true,
+	"SCAN":        true,
+	"SSCAN":       true,
+	"HSCAN":       true,
+	"ZSCAN":       true,
+	"TTL":         true,
+	"PTTL":        true,
+	"TIME":        true,
+	"LASTSAVE":    true,
+	"INFO":        true,
+	"CLIENT":      true,
+	"CONFIG":      true,
+	"DEBUG":       true,
+	"MEMORY":      true,
+	"OBJECT":      true,
+	"COMMAND":     true,
+	"HELLO":       true,
+	"ACL":         true,
+	"MODULE":      true,
+	"LATENCY":     true,
+	"SLOWLOG":     true,
+}
+
+type diffTarget struct {
+	name string
+	db   db.Differ
+}
+
+/*
+ * Diff Functions
+ */
+
+// export
+func Diff(targets []utils.TargetType) {
+
+	if len(targets) < 2 {
+		log.Println("err: diff needs at least 2 targets.")
+		return
+	}
+
+	// queue of the first target
+	queue := utils.Targets[targets[0]][utils.QUEUE_PATH]
+
+	// afl coverage map, first target only
+	virgin, err := NewVirgin()
+
+	if err != nil {
+		log.Println("err: coverage map failed.", err)
+		return
+	}
+
+	cov, err := NewCoverage(virgin, true)
+
+	if err != nil {
+		log.Println("err: coverage map failed.", err)
+		return
+	}
+
+	defer cov.Close()
+
+	dts := make([]*diffTarget, 0, len(targets))
+
+	for i, target := range targets {
+
+		feature := maps.Clone(utils.Targets[target])
+
+		if i == 0 {
+			feature[utils.COVERAGE_ID] = strconv.Itoa(cov.Id())
+		}
+
+		// interface
+		differ, ok := db.NewDB(target, feature).(db.Differ)
+
+		if !ok {
+			log.Printf("err: %s cannot diff.\n", target)
+			return
+		}
+
+		// StartUp target first
+		err = differ.StartUp()
+		defer differ.ShutDown()
+
+		if err != nil {
+			log.Printf("err: %s startup failed.\n", target)
+			return
+		}
+
+		dts = append(dts, &diffTarget{name: differ.Name(), db: differ})
+	}
+
+	chanExit := make(chan struct{})
+
+	// exit control
+	go signalCtl(chanExit)
+
+	// diff server
+	go diffServer(dts, queue, cov)
+
+	// exit
+	<-chanExit
+}
+
+// private
+func diffServer(dts []*diffTarget, queue string, cov *Coverage) {
+
+	corpus, corpusDir := resumeCorpus(dts[0].db, queue, cov, NewStats())
+	loadSchema(dts[0].db, corpus)
+
+	fmt.Println("[*] corpus ok")
+
+	lastSave := time.Now()
+
+	// mutate loop
+	for {
+
+		// new paths since last save
+		if time.Since(lastSave) > StatsInterval {
+			saveCorpus(corpus, corpusDir)
+			lastSave = time.Now()
+		}
+
+		// mutated line, corpus and flags go to header
+		opts := corpus.MutateOpts()
+		opts.Seed = utils.NextSeed()
+		opts.Corpus = corpus.Len()
+		mutated := corpus.Mutate(opts.Seed, opts.Corpus)
+
+		// clean up database
+		for _, dt := range dts {
+
+			err := dt.db.CleanUp()
+
+			if err != nil {
+				log.Printf("%s clean up failed\n", dt.name)
+			}
+		}
+
+		// new coverage
+		interesting := false
+
+	lineLoop:
+		for index, line := range mutated {
+
+			args := line.Text()
+			replies := make([]string, len(dts))
+
+			cov.Reset()
+
+			for i, dt := range dts {
+
+				reply, state, _ := dt.db.ExecuteReply(args)
+
+				// crash
+				if state == utils.STATE_CRASH {
+					fuzzCrash(dt.db, seedJson(opts, mutated), index+1)
+					break lineLoop
+				}
+
+				// hang
+				if state == utils.STATE_HANG {
+					fuzzHang(dt.db, seedJson(opts, mutated), index+1, HangUnresponsive)
+					break lineLoop
+				}
+
+				replies[i] = reply
+			}
+
+			// new edges
+			if cov.HasNewBits() {
+				line.Weight += model.LINE_SCORE_COVER
+				interesting = true
+			}
+
+			// divergence, states differ from here on
+			if !diffSame(args, replies) {
+				diffSave(dts, opts, mutated, index, replies)
+				break
+			}
+		}
+
+		// keep sequence
+		if interesting {
+			corpus.AddLines(mutated)
+		}
+	}
+}
+
+// private
+func diffSame(args []string, replies []string) bool {
+
+	if len(args) == 0 || diffSkip[strings.ToUpper(args[0])] {
+		return true
+	}
+
+	for _, reply := range replies[1:] {
+		if reply != replies[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// private
+func diffSave(dts []*diffTarget, opts utils.LineOpts, lines []*model.Line, index int, replies []string) {
+
+	// lines after divergence never compared
+	lines = lines[:index+1]
+
+	cj := seedJson(opts, lines)
+
+	bytes, err := cj.ToJson()
+
+	if err != nil {
+		log.Println("err: json encode failed.")
+		return
+	}
+
+	// report, signature by cmd and reply kinds
+	cmd := strings.ToUpper(cj[index+1][0])
+	kinds := cmd
+	names := make([]string, 0, len(dts))
+	report := fmt.Sprintf("line %d: %v\n", index+2, cj[index+1])
+
+	for i, dt := range dts {
+		kinds += "|" + dt.name + ":" + replyKind(replies[i])
+		names = append(names, dt.name)
+		report += dt.name + ": " + replies[i] + "\n"
+	}
+
+	sum := sha1.Sum([]byte(kinds))
+	sig := hex.EncodeToString(sum[:])[:16]
+
+	hits, err := SaveBucket(DivergencePath, sig, strings.Join(names, ","), bytes, report)
+
+	if err != nil {
+		log.Println("err: save divergence failed.", err)
+		return
+	}
+
+	fmt.Printf("[*] divergence %s (%s), hits: %d\n", sig, cmd, hits)
+}
+
+// private
+// error class or reply type
+func replyKind(reply string) string {
+
+	switch {
+	case reply == "":
+		return "empty"
+	case reply == "(nil)":
+		return "nil"
+	case reply[0] == '-':
+		return reply
+	case reply[0] == '"':
+		return "str"
+	case reply[0] == '[':
+		return "array"
+	}
+
+	return "int"
+}
@@ -3,54 +3,194 @@ package fuzz
 import (
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	"unicode"
 
+	"github.com/fuxxcss/redi2fuzz/pkg/analyze"
 	"github.com/fuxxcss/redi2fuzz/pkg/db"
 	"github.com/fuxxcss/redi2fuzz/pkg/model"
 	"github.com/fuxxcss/redi2fuzz/pkg/utils"
 )
 
+// hang output, bucket is kind-cmd
+const (
+	HangPath         string = "hangs"
+	HangUnresponsive string = "unresponsive"
+	HangSlow         string = "slow"
+	HANG_CMD_LEN     int    = 32
+)
+
+// per-sequence deadline, per-command one is in db
+const (
+	SequenceTimeout time.Duration = 30 * time.Second
+)
+
+// last corpus save on exit
+const (
+	CorpusSaveTimeout time.Duration = 10 * time.Second
+)
+
+// fuzz options
+type Options struct {
+	// parallel workers
+	Jobs int
+	// raw resp executor
+	Raw  bool
+	// percent of binding a key of another type
+	Confusion int
+	// no status screen
+	Quiet bool
+	// prometheus listener, e.g. :9100
+	MetricsAddr string
+	// persistence oracle, rdb, aof or both
+	Persist string
+	// master/replica pair per worker
+	Repl bool
+	// CONFIG SET before sequences
+	ConfigSet bool
+	// startup profile name or round-robin
+	Profile string
+}
+
 // export
-func Fuzz(target utils.TargetType) {
+func Fuzz(target utils.TargetType, opts Options) {
+
+	// Fuzz Target (redis, keydb, valkey, redis-stack, redis-cluster)
+	base := utils.Targets[target]
+	queue := base[utils.QUEUE_PATH]
+
+	port, err := strconv.Atoi(base[utils.TARGET_PORT])
 
-	// Fuzz Target (redis, keydb, redis-stack)
-	feature := utils.Targets[target]
-	queue := feature[utils.QUEUE_PATH]
+	if err != nil {
+		log.Println("err: target port invalid.")
+		return
+	}
 
-	// interface
-	var DBtarget db.DB
+	// edges seen by all workers
+	virgin, err := NewVirgin()
 
-	switch target {
-	// Redi
-	case utils.REDI_REDIS, utils.REDI_KEYDB, utils.REDI_STACK:
-		DBtarget = db.NewRedi(feature)
+	if err != nil {
+		log.Println("err: coverage map failed.", err)
+		return
 	}
 
-	// StartUp target first
-	err := DBtarget.StartUp()
-	defer DBtarget.ShutDown()
+	// startup args per worker
+	profiles, err := utils.ParseProfiles(utils.Targets[target], opts.Profile)
 
 	if err != nil {
-		log.Println("err: db startup failed.")
+		log.Println("err:", err)
 		return
 	}
 
+	stats := NewStats()
+	workers := make([]*worker, 0, opts.Jobs)
+
+	// ports per worker
+	stride := 1
+
+	if opts.Repl {
+		stride = db.REPL_PORTS
+	}
+
+	if target.Kind() == utils.REDI_CLUSTER {
+		stride = db.CLUSTER_NODES
+	}
+
+	for i := 0; i < opts.Jobs; i++ {
+
+		// one port per worker
+		feature := maps.Clone(base)
+		feature[utils.TARGET_PORT] = strconv.Itoa(port + i*stride)
+
+		// afl coverage map
+		cov, err := NewCoverage(virgin, i == 0)
+
+		if err != nil {
+			log.Println("err: coverage map failed.", err)
+			return
+		}
+
+		defer cov.Close()
+
+		feature[utils.COVERAGE_ID] = strconv.Itoa(cov.Id())
+
+		// oracles need DEBUG, keydb has it on
+		if (opts.Persist != "" || opts.Repl) && target.Kind() != utils.REDI_KEYDB {
+			feature[utils.TARGET_ARGS] += " " + db.RediDebugArg
+		}
+
+		// workers start on different profiles
+		if profiles != nil {
+			feature[utils.TARGET_PROFILE] = strings.Join(profiles[i%len(profiles)].Args, " ")
+		}
+
+		// interface
+		var DBtarget db.DB
+
+		if opts.Repl {
+			DBtarget = db.NewReplDB(target, feature)
+		} else {
+			DBtarget = db.NewDB(target, feature)
+		}
+
+		if DBtarget == nil {
+			log.Println("err: target is not support.")
+			return
+		}
+
+		// StartUp target first
+		err = DBtarget.StartUp()
+		defer DBtarget.ShutDown()
+
+		if err != nil {
+			log.Println("err: db startup failed.")
+			return
+		}
+
+		w, err := newWorker(i, DBtarget, cov, stats, opts)
+
+		if err != nil {
+			log.Println("err:", err)
+			return
+		}
+
+		err = w.setProfiles(profiles)
+
+		if err != nil {
+			log.Println("err:", err)
+			return
+		}
+
+		workers = append(workers, w)
+	}
+
 	chanExit := make(chan struct{})
 
 	// exit control
 	go signalCtl(chanExit)
 
-	// fuzz server
-	go fuzzServer(DBtarget, queue)
+	// fuzz server, saves corpus after quit
+	quit := make(chan struct{})
+	saved := make(chan struct{})
+
+	go fuzzServer(workers, queue, stats, opts, quit, saved)
 
 	// exit
 	<-chanExit
+	close(quit)
 
+	// corpus may still be loading
+	select {
+	case <-saved:
+	case <-time.After(CorpusSaveTimeout):
+	}
 }
 
 // static
@@ -68,10 +208,150 @@ func signalCtl(chanExit chan<- struct{}) {
 }
 
 // private
-func fuzzServer(target db.DB, queue string) {
+func fuzzServer(workers []*worker, queue string, stats *Stats, opts Options, quit <-chan struct{}, saved chan<- struct{}) {
+
+	// first worker builds corpus
+	corpus, corpusDir := resumeCorpus(workers[0].target, queue, workers[0].cov, stats)
+	setupCorpus(workers[0].target, corpus, opts)
+
+	fmt.Println("[*] corpus ok")
+	fmt.Printf("[*] coverage edges: %d\n", workers[0].cov.Edges())
+
+	for _, w := range workers {
+		go w.run(corpus)
+	}
+
+	// prometheus endpoint
+	if opts.MetricsAddr != "" {
+		go serveMetrics(opts.MetricsAddr, workers, corpus, stats)
+	}
+
+	// stats of all workers
+	statsPath := filepath.Join(corpusDir, StatsFile)
+	lastSave := time.Now()
+
+	for {
+
+		select {
+
+		// new paths of this run
+		case <-quit:
+			saveCorpus(corpus, corpusDir)
+			close(saved)
+			return
+
+		case <-time.After(StatusInterval):
+		}
+
+		// status screen
+		if !opts.Quiet {
+			fmt.Print(StatusClear)
+			fmt.Print(stats.Status(workers[0].target.Name(), corpus.Len(), workers[0].cov.Edges()))
+		}
+
+		if time.Since(lastSave) < StatsInterval {
+			continue
+		}
+
+		lastSave = time.Now()
+		err := stats.Save(statsPath, corpus.Len(), workers[0].cov.Edges())
+
+		if err != nil {
+			log.Println("err: save stats failed.", err)
+		}
+
+		// new paths since last save
+		saveCorpus(corpus, corpusDir)
+	}
+}
+
+// private
+// only if lines were added, failure only logs
+func saveCorpus(corpus *model.Corpus, corpusDir string) {
+
+	if !corpus.Dirty() {
+		return
+	}
+
+	err := corpus.Save(corpusDir)
+
+	if err != nil {
+		log.Println("err: save corpus failed.", err)
+	}
+}
+
+// private
+// load corpus-json, or init from queue
+func resumeCorpus(target db.DB, queue string, cov *Coverage, stats *Stats) (*model.Corpus, string) {
+
+	// resume corpus
+	corpusDir := filepath.Join(model.CorpusPath, filepath.Base(queue))
+	corpus, err := model.LoadCorpus(corpusDir, target.LineSep(), target.TokenSep())
+
+	if err == nil {
+		fmt.Printf("[*] resume corpus from %s\n", corpusDir)
 
 	// init corpus
-	corpus := model.NewCorpus()
+	} else {
+		if !os.IsNotExist(err) {
+			log.Println("err: load corpus failed.", err)
+		}
+
+		corpus = initCorpus(target, queue, cov, stats)
+		corpus.Debug()
+
+		err = corpus.Save(corpusDir)
+
+		if err != nil {
+			log.Println("err: save corpus failed.", err)
+		}
+	}
+
+	return corpus, corpusDir
+}
+
+// private
+// mutations enabled by target and options, same for Regen
+func setupCorpus(target db.DB, corpus *model.Corpus, opts Options) {
+
+	loadSchema(target, corpus)
+	corpus.SetConfusion(opts.Confusion)
+
+	// MULTI, WATCH and pipelines need own connections, raw lines are never grouped
+	_, pipelined := target.(db.Pipeliner)
+	_, multi := target.(db.MultiClient)
+	corpus.SetSequence(!opts.Raw && pipelined && multi)
+
+	// redis family, EVAL and FUNCTION LOAD
+	_, lua := target.(db.Documenter)
+	corpus.SetScript(lua)
+}
+
+// private
+// grammar mutation, if target documents its commands
+func loadSchema(target db.DB, corpus *model.Corpus) {
+
+	documenter, ok := target.(db.Documenter)
+
+	if !ok {
+		return
+	}
+
+	schema, err := documenter.Schema()
+
+	if err != nil {
+		log.Println("err: load schema failed.", err)
+		return
+	}
+
+	corpus.SetSchema(schema)
+	fmt.Printf("[*] schema: %d commands\n", len(schema))
+}
+
+// private
+func initCorpus(target db.DB, queue string, cov *Coverage, stats *Stats) *model.Corpus {
+
+	corpus := model.NewCorpus(target.LineSep(), target.TokenSep())
 	fmt.Println("[*] init corpus...")
 
 	var lines []*model.Line
@@ -103,61 +383,19 @@ func fuzzServer(target db.DB, queue string) {
 		}
 
 		// fuzz loop
-		fuzzLoop(target, lines)
+		fuzzLoop(target, lines, cov, stats)
 
 		return nil
 	})
 
-	corpus.Debug()
-
-	log.Fatal()
-	fmt.Println("[*] corpus ok")
-
-	// mutate loop
-	tryCnt := 0
-
-	for {
-
-		// mutated line
-		mutated := corpus.Mutate()
-
-		// clean up database
-		err := target.CleanUp()
-
-		if err != nil {
-			log.Println("clean up failed")
-		}
-
-		for index, line := range mutated {
-
-			// execute
-			args := line.Text()
-			state, err := target.Execute(args)
-
-			// print
-			fmt.Println(utils.Divide)
-			fmt.Printf("fuzz count: %d\n", tryCnt)
-			fmt.Printf("fuzz line: %s\n", args)
-
-			if err != nil {
-				fmt.Println(err)
-			}
-
-			// crash
-			if state == utils.STATE_CRASH {
-				fuzzCrash(target, mutated, index)
-			}
-		}
-
-		tryCnt++
-	}
+	return corpus
 }
 
 // private
-func fuzzLoop(target db.DB, lines []*model.Line) {
+func fuzzLoop(target db.DB, lines []*model.Line, cov *Coverage, stats *Stats) {
 
-	// snapshot
-	var snapshot model.Snapshot
+	// snapshot before each line
+	old := model.NewSnapshot()
 
 	okCnt := len(lines)
 
@@ -165,6 +403,8 @@ func fuzzLoop(target db.DB, lines []*model.Line) {
 
 		// execute
 		args := line.Text()
+
+		cov.Reset()
 		state, err := target.Execute(args)
 
 		switch state {
@@ -172,20 +412,28 @@ func fuzzLoop(target db.DB, lines []*model.Line) {
 		// ok
 		case utils.STATE_OK:
 
+			// seed edges
+			if cov.HasNewBits() {
+				line.Weight += model.LINE_SCORE_COVER
+			}
+
 			// collect snapshot
-			snapshot, err = target.Collect()
+			snapshot, err := target.Collect()
 
 			if err != nil {
 				log.Println("err: Collect Snapshot ", err)
+				continue
 			}
 
 			// build line
-			err = line.Build(snapshot)
+			err = line.Build(old, snapshot)
 
 			if err != nil {
 				log.Println("err: Build Line ", err)
 			}
 
+			old = snapshot
+
 		// err
 		case utils.STATE_ERR:
 
@@ -196,7 +444,12 @@ func fuzzLoop(target db.DB, lines []*model.Line) {
 		// crash
 		case utils.STATE_CRASH:
 
-			fuzzCrash(target, lines, index)
+			fuzzCrash(target, crashJson(lines), index)
+
+		// hang
+		case utils.STATE_HANG:
+
+			fuzzHang(target, crashJson(lines), index, HangUnresponsive)
 		}
 
 	}
@@ -210,40 +463,119 @@ func fuzzLoop(target db.DB, lines []*model.Line) {
 }
 
 // private
-func fuzzCrash(target db.DB, lines []*model.Line, index int) {
+func crashJson(lines []*model.Line) utils.CrashJson {
 
-	t := time.Now().UnixNano()
-	name := "poc/" + strconv.FormatInt(t, 10)
+	cj := make(utils.CrashJson, len(lines))
 
-	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	for i, line := range lines {
+		cj[i] = line.Encode()
+	}
+
+	return cj
+}
+
+// private
+// @seed=n @corpus=n ... header, then lines
+func seedJson(opts utils.LineOpts, lines []*model.Line) utils.CrashJson {
+
+	header := utils.EncodeLine(opts, nil)
+
+	return append(utils.CrashJson{header}, crashJson(lines)...)
+}
+
+// private
+// cj is what was executed, one entry per line, return bucket hits
+func fuzzCrash(target db.DB, cj utils.CrashJson, index int) int {
+
+	// lines after crash never run
+	cj = cj[:index+1]
+
+	// to json
+	bytes, err := cj.ToJson()
 
 	// don't miss crash
 	if err != nil {
-		crashPrint(lines, index)
+		crashPrint(cj, index)
 	}
 
-	// log crash in json
-	size := len(lines)
-	cj := make(utils.CrashJson, size)
+	// dedup by stack signature
+	stderr := target.Stderr()
+	sig := analyze.Signature(stderr)
 
-	for i, line := range lines {
-		cj[i] = line.Text()
+	hits, err := SaveBucket(PocPath, sig, target.Name(), bytes, stderr)
+
+	if err != nil {
+		crashPrint(cj, index)
 	}
 
-	// to json
+	fmt.Printf("[*] %s crash %s, hits: %d\n", target.Name(), sig, hits)
+
+	// restart
+	target.Restart()
+
+	return hits
+}
+
+// private
+// unresponsive target is restarted, slow one keeps running
+func fuzzHang(target db.DB, cj utils.CrashJson, index int, kind string) int {
+
+	// lines after hang never run
+	cj = cj[:index+1]
+
 	bytes, err := cj.ToJson()
 
 	if err != nil {
-		crashPrint(lines, index)
+		crashPrint(cj, index)
 	}
 
-	file.Write(bytes)
+	stderr := ""
 
-	// restart
-	target.Restart()
+	// kill first, stderr is complete
+	if kind == HangUnresponsive {
+		target.ShutDown()
+		stderr = target.Stderr()
+	}
+
+	sig := kind + "-" + hangCmd(cj[index])
+	hits, err := SaveBucket(HangPath, sig, target.Name(), bytes, stderr)
+
+	if err != nil {
+		crashPrint(cj, index)
+	}
+
+	fmt.Printf("[*] %s hang %s, hits: %d\n", target.Name(), sig, hits)
+
+	if kind == HangUnresponsive {
+		target.StartUp()
+	}
+
+	return hits
+}
+
+// private
+// command name as bucket dir
+func hangCmd(line []string) string {
+
+	_, line = utils.DecodeLine(line)
+
+	if len(line) == 0 {
+		return "empty"
+	}
+
+	cmd := strings.Map(func(r rune) rune {
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' {
+			return unicode.ToLower(r)
+		}
+
+		return '_'
+	}, line[0])
+
+	return cmd[:min(len(cmd), HANG_CMD_LEN)]
 }
 
-func crashPrint(lines []*model.Line, index int) {
+func crashPrint(cj utils.CrashJson, index int) {
 
 	// alert
 	alert := "[*] Found a crash :)\n"
@@ -252,16 +584,15 @@ func crashPrint(lines []*model.Line, index int) {
 
 	var crash string
 
-	for _, line := range lines {
+	for _, texts := range cj {
 
 		var str string
-		texts := line.Text()
 
 		for _, text := range texts {
-			str += text + model.TokenSep
+			str += text + " "
 		}
 
-		crash += str + model.LineSep
+		crash += str + "\n"
 	}
 
 	fmt.Println(alert)
@@ -0,0 +1,175 @@
+package fuzz
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+)
+
+/*
+ * Metrics Definition
+ */
+
+// prometheus text format
+const (
+	MetricsPath        string = "/metrics"
+	MetricsContentType string = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// one scrape
+type metrics struct {
+	buf strings.Builder
+}
+
+/*
+ * Metrics Functions
+ */
+
+// private
+// serve until exit, failure only logs
+func serveMetrics(addr string, workers []*worker, corpus *model.Corpus, stats *Stats) {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(MetricsPath, func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Content-Type", MetricsContentType)
+		w.Write([]byte(scrape(workers, corpus, stats)))
+	})
+
+	fmt.Printf("[*] metrics on http://%s%s\n", addr, MetricsPath)
+
+	err := http.ListenAndServe(addr, mux)
+
+	if err != nil {
+		log.Println("err: metrics server failed.", err)
+	}
+}
+
+// private
+func scrape(workers []*worker, corpus *model.Corpus, stats *Stats) string {
+
+	m := new(metrics)
+
+	m.metric("r2f_executions_total", "counter", "Executions by target state, a pipeline is one.")
+	m.sample("r2f_executions_total", `state="ok"`, stats.Oks.Load())
+	m.sample("r2f_executions_total", `state="err"`, stats.Errs.Load())
+	m.sample("r2f_executions_total", `state="crash"`, stats.Crashes.Load())
+	m.sample("r2f_executions_total", `state="hang"`, stats.Hangs.Load())
+
+	m.metric("r2f_sequences_total", "counter", "Executed mutated sequences.")
+	m.sample("r2f_sequences_total", "", stats.Sequences.Load())
+
+	m.metric("r2f_restarts_total", "counter", "Target restarts after a crash or hang.")
+	m.sample("r2f_restarts_total", "", stats.Restarts.Load())
+
+	m.metric("r2f_crash_buckets", "gauge", "Unique crash buckets found by this run.")
+	m.sample("r2f_crash_buckets", "", stats.Buckets.Load())
+
+	m.metric("r2f_hang_buckets", "gauge", "Unique hang buckets found by this run.")
+	m.sample("r2f_hang_buckets", "", stats.HangBuckets.Load())
+
+	m.metric("r2f_persist_findings_total", "counter", "Persistence digest mismatches and loader crashes.")
+	m.sample("r2f_persist_findings_total", "", stats.Persists.Load())
+
+	m.metric("r2f_repl_divergences_total", "counter", "Master and replica digest mismatches.")
+	m.sample("r2f_repl_divergences_total", "", stats.ReplDiffs.Load())
+
+	m.metric("r2f_paths_total", "counter", "Sequences with new coverage.")
+	m.sample("r2f_paths_total", "", stats.Paths.Load())
+
+	m.metric("r2f_corpus_lines", "gauge", "Lines in corpus.")
+	m.sample("r2f_corpus_lines", "", int64(corpus.Len()))
+
+	m.metric("r2f_corpus_weight", "gauge", "Total weight of corpus lines.")
+	m.sample("r2f_corpus_weight", "", corpus.Weight())
+
+	m.metric("r2f_coverage_edges", "gauge", "Edges seen by all workers.")
+	m.sample("r2f_coverage_edges", "", int64(workers[0].cov.Edges()))
+
+	m.metric("r2f_coverage_seconds", "summary", "Coverage check latency per sequence.")
+	m.sampleFloat("r2f_coverage_seconds_sum", "", time.Duration(stats.coverageNanos.Load()).Seconds())
+	m.sample("r2f_coverage_seconds_count", "", stats.coverages.Load())
+
+	m.metric("r2f_target_rss_bytes", "gauge", "Resident set size of each target.")
+
+	for _, w := range workers {
+
+		proc, ok := w.target.(db.Processor)
+
+		if !ok {
+			continue
+		}
+
+		rss, err := readRSS(proc.Pid())
+
+		// not running
+		if err != nil {
+			continue
+		}
+
+		labels := fmt.Sprintf(`worker="%d",target="%s"`, w.id, w.target.Name())
+		m.sample("r2f_target_rss_bytes", labels, rss)
+	}
+
+	return m.buf.String()
+}
+
+// private
+func (self *metrics) metric(name, kind, help string) {
+
+	fmt.Fprintf(&self.buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(&self.buf, "# TYPE %s %s\n", name, kind)
+}
+
+// private
+func (self *metrics) sample(name, labels string, value int64) {
+
+	self.sampleFloat(name, labels, float64(value))
+}
+
+// private
+func (self *metrics) sampleFloat(name, labels string, value float64) {
+
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+
+	fmt.Fprintf(&self.buf, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// private
+// /proc/pid/statm, resident pages
+func readRSS(pid int) (int64, error) {
+
+	if pid == 0 {
+		return 0, os.ErrNotExist
+	}
+
+	statm, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/statm")
+
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(statm))
+
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("statm of %d invalid.", pid)
+	}
+
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return pages * int64(os.Getpagesize()), nil
+}
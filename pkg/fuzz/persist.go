@@ -0,0 +1,171 @@
+package fuzz
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/analyze"
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Persist Definition
+ */
+
+// persistence oracle output
+const (
+	PersistPath string = "persist"
+)
+
+// oracle modes
+const (
+	PersistRdb  string = "rdb"
+	PersistAof  string = "aof"
+	PersistBoth string = "both"
+)
+
+/*
+ * Persist Functions
+ */
+
+// public
+func ParsePersist(mode string) error {
+
+	switch mode {
+	case "", PersistRdb, PersistAof, PersistBoth:
+		return nil
+	}
+
+	return fmt.Errorf("persist %s is not support", mode)
+}
+
+// private
+// digest, reload, digest again
+func (self *worker) persistCheck(cj utils.CrashJson) {
+
+	mode := self.persist
+
+	if mode == PersistBoth {
+		mode = []string{PersistRdb, PersistAof}[self.rng.Int(2)]
+	}
+
+	before, err := self.persister.Digest()
+
+	if err != nil {
+		log.Println("err: digest failed.", err)
+		return
+	}
+
+	// appended to crash file, analyze replays the round trip
+	sent, state, err := self.persister.Reload(mode == PersistAof)
+	cj = append(cj, sent...)
+
+	switch state {
+
+	// loader crash
+	case utils.STATE_CRASH, utils.STATE_HANG:
+		stderr := self.target.Stderr()
+		sig := mode + "-crash-" + analyze.Signature(stderr)
+
+		persistSave(self.target, sig, cj, stderr)
+		self.stats.Persists.Add(1)
+		self.stats.Restarts.Add(1)
+		self.target.Restart()
+
+		return
+
+	// e.g. MISCONF, not a bug
+	case utils.STATE_ERR:
+		log.Printf("err: %s reload failed. %v\n", mode, err)
+		return
+	}
+
+	after, err := self.persister.Digest()
+
+	if err != nil {
+		log.Println("err: digest failed.", err)
+		return
+	}
+
+	// round trip ok
+	if digestSame(before, after) {
+		return
+	}
+
+	sig, report := digestReport(mode, before, after)
+
+	persistSave(self.target, sig, cj, report)
+	self.stats.Persists.Add(1)
+}
+
+// private
+func digestSame(a, b *db.Digest) bool {
+
+	// whole digest covers volatile keys too
+	same := a.All == b.All || a.Volatile || b.Volatile
+
+	return same && maps.Equal(a.Keys, b.Keys)
+}
+
+// private
+// signature by mode and types of differing keys
+func digestReport(mode string, before, after *db.Digest) (string, string) {
+
+	report := fmt.Sprintf("%s digest: %s ---> %s\n", mode, before.All, after.All)
+	types := make([]string, 0)
+
+	// keys of both sides
+	union := maps.Clone(before.Keys)
+	maps.Copy(union, after.Keys)
+
+	for _, key := range slices.Sorted(maps.Keys(union)) {
+
+		old, new := before.Keys[key], after.Keys[key]
+
+		if old == new {
+			continue
+		}
+
+		report += fmt.Sprintf("%q: %s ---> %s\n", key, old, new)
+
+		// missing key on one side
+		keyType, _, _ := strings.Cut(old+new, ":")
+
+		if !slices.Contains(types, keyType) {
+			types = append(types, keyType)
+		}
+	}
+
+	slices.Sort(types)
+
+	sum := sha1.Sum([]byte(mode + "|" + strings.Join(types, "|")))
+	sig := mode + "-mismatch-" + hex.EncodeToString(sum[:])[:analyze.SIGNATURE_LEN]
+
+	return sig, report
+}
+
+// private
+func persistSave(target db.DB, sig string, cj utils.CrashJson, report string) {
+
+	bytes, err := cj.ToJson()
+
+	if err != nil {
+		log.Println("err: json encode failed.")
+		return
+	}
+
+	hits, err := SaveBucket(PersistPath, sig, target.Name(), bytes, report)
+
+	if err != nil {
+		log.Println("err: save persist failed.", err)
+		return
+	}
+
+	fmt.Printf("[*] %s persist %s, hits: %d\n", target.Name(), sig, hits)
+}
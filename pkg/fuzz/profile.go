@@ -0,0 +1,84 @@
+package fuzz
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Profile Definition
+ */
+
+// round-robin, restart on next profile
+const (
+	ProfileInterval time.Duration = 10 * time.Minute
+)
+
+/*
+ * Profile Functions
+ */
+
+// private
+// worker id picks the first profile, same as its startup args
+func (self *worker) setProfiles(profiles []utils.Profile) error {
+
+	if profiles == nil {
+		return nil
+	}
+
+	// rotate on restart
+	if len(profiles) > 1 {
+
+		_, ok := self.target.(db.Profiler)
+
+		if !ok {
+			return errors.New("target has no startup profile.")
+		}
+	}
+
+	self.profiles = profiles
+	self.profile = self.id % len(profiles)
+	self.profiled = time.Now()
+
+	return nil
+}
+
+// private
+// next profile after interval, restart with its args
+func (self *worker) profileRotate() {
+
+	if len(self.profiles) < 2 || time.Since(self.profiled) < ProfileInterval {
+		return
+	}
+
+	self.profile = (self.profile + 1) % len(self.profiles)
+	self.profiled = time.Now()
+
+	profiler := self.target.(db.Profiler)
+	profiler.SetProfile(self.profiles[self.profile].Args)
+
+	self.stats.Restarts.Add(1)
+	err := self.target.Restart()
+
+	if err != nil {
+		log.Printf("worker %d restart failed\n", self.id)
+	}
+
+	// config values differ per profile
+	if self.configs == nil {
+		return
+	}
+
+	configs, err := loadConfig(self.target.(db.Configurer))
+
+	if err != nil || len(configs) == 0 {
+		log.Println("err: load config failed.", err)
+		return
+	}
+
+	self.configs = configs
+}
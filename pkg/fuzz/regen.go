@@ -0,0 +1,93 @@
+package fuzz
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/analyze"
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Regen Functions
+ */
+
+// export
+// mutated lines of the header of a crash file, corpus as saved by fuzz
+func Regen(target utils.TargetType, opts Options, path string) {
+
+	cj, err := analyze.LoadCrash(path)
+
+	if err != nil {
+		log.Println("err: crash file failed.", err)
+		return
+	}
+
+	header, ok := utils.CrashHeader(cj)
+
+	if !ok || header.Seed == 0 {
+		log.Println("err: crash file has no @seed header.")
+		return
+	}
+
+	feature := maps.Clone(utils.Targets[target])
+
+	// schema needs a running target
+	DBtarget := db.NewDB(target, feature)
+
+	if DBtarget == nil {
+		log.Println("err: target is not support.")
+		return
+	}
+
+	err = DBtarget.StartUp()
+	defer DBtarget.ShutDown()
+
+	if err != nil {
+		log.Println("err: db startup failed.")
+		return
+	}
+
+	corpusDir := filepath.Join(model.CorpusPath, filepath.Base(feature[utils.QUEUE_PATH]))
+	corpus, err := model.LoadCorpus(corpusDir, DBtarget.LineSep(), DBtarget.TokenSep())
+
+	if err != nil {
+		log.Println("err: load corpus failed.", err)
+		return
+	}
+
+	setupCorpus(DBtarget, corpus, opts)
+
+	switch {
+
+	// old header, whole corpus and flags of this run
+	case header.Corpus == 0:
+		fmt.Println("[*] no @corpus in header, using the whole corpus and current flags")
+
+		flags := corpus.MutateOpts()
+		header.Corpus = corpus.Len()
+		header.Sequence, header.Script, header.Confusion = flags.Sequence, flags.Script, flags.Confusion
+
+	// corpus of another queue or run
+	case header.Corpus > corpus.Len():
+		log.Printf("err: corpus has %d lines, seed needs %d.\n", corpus.Len(), header.Corpus)
+		return
+
+	default:
+		corpus.SetMutateOpts(header)
+	}
+
+	cj = seedJson(header, corpus.Mutate(header.Seed, header.Corpus))
+	bytes, err := cj.ToJson()
+
+	if err != nil {
+		log.Println("err: json encode failed.")
+		return
+	}
+
+	fmt.Println(string(bytes))
+}
@@ -0,0 +1,71 @@
+package fuzz
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Repl Definition
+ */
+
+// replication oracle output
+const (
+	ReplicationPath string = "replication"
+	ReplMode        string = "repl"
+)
+
+/*
+ * Repl Functions
+ */
+
+// private
+// wait replica, compare digests
+func (self *worker) replCheck(cj utils.CrashJson) {
+
+	state, err := self.replicator.Sync()
+
+	switch state {
+
+	// side in stderr
+	case utils.STATE_CRASH, utils.STATE_HANG:
+		self.fail(state, cj, len(cj)-1, HangUnresponsive)
+		return
+
+	case utils.STATE_ERR:
+		log.Println("err: replica sync failed.", err)
+		return
+	}
+
+	master, replica, err := self.replicator.Digests()
+
+	if err != nil {
+		log.Println("err: digest failed.", err)
+		return
+	}
+
+	if digestSame(master, replica) {
+		return
+	}
+
+	sig, report := digestReport(ReplMode, master, replica)
+
+	bytes, err := cj.ToJson()
+
+	if err != nil {
+		log.Println("err: json encode failed.")
+		return
+	}
+
+	hits, err := SaveBucket(ReplicationPath, sig, self.target.Name(), bytes, report)
+
+	if err != nil {
+		log.Println("err: save replication failed.", err)
+		return
+	}
+
+	self.stats.ReplDiffs.Add(1)
+	fmt.Printf("[*] %s replica diverged %s, hits: %d\n", self.target.Name(), sig, hits)
+}
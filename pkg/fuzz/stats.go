@@ -0,0 +1,199 @@
+package fuzz
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * Stats Definition
+ */
+
+// stats output
+const (
+	StatsFile      string        = "fuzzer_stats"
+	StatsInterval  time.Duration = 5 * time.Second
+	StatusInterval time.Duration = time.Second
+)
+
+// status screen
+const (
+	STATUS_TOP_ERRORS int    = 5
+	StatusClear       string = "\033[H\033[2J"
+)
+
+// shared by workers
+type Stats struct {
+	start     time.Time
+	Execs     atomic.Int64
+	Sequences atomic.Int64
+	Crashes   atomic.Int64
+	Paths     atomic.Int64
+
+	// exec states
+	Oks       atomic.Int64
+	Errs      atomic.Int64
+
+	// unique crash buckets
+	Buckets   atomic.Int64
+	Restarts  atomic.Int64
+
+	// persistence mismatches, loader crashes
+	Persists    atomic.Int64
+
+	// replica digest mismatches
+	ReplDiffs   atomic.Int64
+
+	// hangs, unique hang buckets
+	Hangs       atomic.Int64
+	HangBuckets atomic.Int64
+
+	// coverage check latency, per sequence
+	coverages     atomic.Int64
+	coverageNanos atomic.Int64
+
+	// unix nano of last new path
+	lastPath  atomic.Int64
+
+	// erroring commands
+	errMu     sync.Mutex
+	errCmds   map[string]int64
+
+	// status speed, status goroutine only
+	prevExecs int64
+	prevTime  time.Time
+}
+
+/*
+ * Stats Functions
+ */
+
+// public
+func NewStats() *Stats {
+
+	stats := new(Stats)
+	stats.start = time.Now()
+	stats.prevTime = stats.start
+	stats.errCmds = make(map[string]int64, 0)
+
+	return stats
+}
+
+// public
+func (self *Stats) NewPath() {
+
+	self.Paths.Add(1)
+	self.lastPath.Store(time.Now().UnixNano())
+}
+
+// public
+func (self *Stats) ObserveCoverage(latency time.Duration) {
+
+	self.coverages.Add(1)
+	self.coverageNanos.Add(int64(latency))
+}
+
+// public
+func (self *Stats) AddError(cmd string) {
+
+	self.Errs.Add(1)
+
+	self.errMu.Lock()
+	defer self.errMu.Unlock()
+
+	self.errCmds[strings.ToUpper(cmd)]++
+}
+
+// private
+// most erroring commands first
+func (self *Stats) topErrors(n int) []string {
+
+	self.errMu.Lock()
+	defer self.errMu.Unlock()
+
+	cmds := slices.SortedFunc(maps.Keys(self.errCmds), func(a, b string) int {
+		return cmp.Or(cmp.Compare(self.errCmds[b], self.errCmds[a]), strings.Compare(a, b))
+	})
+
+	ret := make([]string, 0, n)
+
+	for _, cmd := range cmds[:min(n, len(cmds))] {
+		ret = append(ret, fmt.Sprintf("%s (%d)", cmd, self.errCmds[cmd]))
+	}
+
+	return ret
+}
+
+// public
+func (self *Stats) Save(path string, corpus, edges int) error {
+
+	elapsed := time.Since(self.start).Seconds()
+	execs := self.Execs.Load()
+
+	content := fmt.Sprintf("start_time        : %d\n", self.start.Unix())
+	content += fmt.Sprintf("run_time          : %d\n", int64(elapsed))
+	content += fmt.Sprintf("execs_done        : %d\n", execs)
+	content += fmt.Sprintf("execs_per_sec     : %.2f\n", float64(execs)/max(elapsed, 1))
+	content += fmt.Sprintf("sequences_done    : %d\n", self.Sequences.Load())
+	content += fmt.Sprintf("corpus_count      : %d\n", corpus)
+	content += fmt.Sprintf("paths_found       : %d\n", self.Paths.Load())
+	content += fmt.Sprintf("last_path         : %d\n", self.lastPath.Load()/int64(time.Second))
+	content += fmt.Sprintf("edges_found       : %d\n", edges)
+	content += fmt.Sprintf("crashes           : %d\n", self.Crashes.Load())
+	content += fmt.Sprintf("unique_crashes    : %d\n", self.Buckets.Load())
+	content += fmt.Sprintf("hangs             : %d\n", self.Hangs.Load())
+	content += fmt.Sprintf("unique_hangs      : %d\n", self.HangBuckets.Load())
+	content += fmt.Sprintf("persist_findings  : %d\n", self.Persists.Load())
+	content += fmt.Sprintf("repl_divergences  : %d\n", self.ReplDiffs.Load())
+
+	return os.WriteFile(path, []byte(content), 0664)
+}
+
+// public
+// afl like status screen, call once per StatusInterval
+func (self *Stats) Status(target string, corpus, edges int) string {
+
+	now := time.Now()
+	execs := self.Execs.Load()
+
+	// current speed
+	speed := float64(execs-self.prevExecs) / max(now.Sub(self.prevTime).Seconds(), 0.001)
+	self.prevExecs = execs
+	self.prevTime = now
+
+	// ratio of execs
+	ratio := func(n int64) float64 {
+		return float64(n) * 100 / float64(max(execs, 1))
+	}
+
+	// last new path
+	lastPath := "none yet"
+
+	if last := self.lastPath.Load(); last != 0 {
+		lastPath = now.Sub(time.Unix(0, last)).Truncate(time.Second).String() + " ago"
+	}
+
+	content := fmt.Sprintf("==== redi2fuzz (%s) ====\n", target)
+	content += fmt.Sprintf("  run time     : %s\n", now.Sub(self.start).Truncate(time.Second))
+	content += fmt.Sprintf("  exec speed   : %.0f/sec\n", speed)
+	content += fmt.Sprintf("  total execs  : %d\n", execs)
+	content += fmt.Sprintf("  sequences    : %d\n", self.Sequences.Load())
+	content += fmt.Sprintf("  corpus       : %d\n", corpus)
+	content += fmt.Sprintf("  edges        : %d\n", edges)
+	content += fmt.Sprintf("  last path    : %s\n", lastPath)
+	content += fmt.Sprintf("  ok/err/crash : %.1f%% / %.1f%% / %.1f%%\n", ratio(self.Oks.Load()), ratio(self.Errs.Load()), ratio(self.Crashes.Load()))
+	content += fmt.Sprintf("  crashes      : %d (%d unique)\n", self.Crashes.Load(), self.Buckets.Load())
+	content += fmt.Sprintf("  hangs        : %d (%d unique)\n", self.Hangs.Load(), self.HangBuckets.Load())
+	content += fmt.Sprintf("  persist      : %d\n", self.Persists.Load())
+	content += fmt.Sprintf("  replica diff : %d\n", self.ReplDiffs.Load())
+	content += fmt.Sprintf("  top errors   : %s\n", strings.Join(self.topErrors(STATUS_TOP_ERRORS), ", "))
+
+	return content
+}
@@ -0,0 +1,337 @@
+package fuzz
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"log"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/db"
+	"github.com/fuxxcss/redi2fuzz/pkg/model"
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Worker Definition
+ */
+
+// one target, one goroutine
+type worker struct {
+	id     int
+	target db.DB
+	cov    *Coverage
+	stats  *Stats
+
+	// raw resp executor
+	raw    db.RawExecutor
+
+	// persistence oracle, rdb, aof or both
+	persist   string
+	persister db.Persister
+
+	// master/replica oracle
+	replicator db.Replicator
+
+	// mutable runtime config
+	configs []configParam
+
+	// worker decisions, seeded per sequence
+	rng  *utils.Rand
+	seed uint64
+	// corpus lines and flags of the sequence
+	opts utils.LineOpts
+
+	// startup profiles, current one and since when
+	profiles []utils.Profile
+	profile  int
+	profiled time.Time
+}
+
+/*
+ * Worker Functions
+ */
+
+// private
+func newWorker(id int, target db.DB, cov *Coverage, stats *Stats, opts Options) (*worker, error) {
+
+	w := new(worker)
+	w.id = id
+	w.target = target
+	w.cov = cov
+	w.stats = stats
+	w.rng = utils.NewRand(0)
+
+	if opts.Raw {
+
+		raw, ok := target.(db.RawExecutor)
+
+		if !ok {
+			return nil, errors.New("target has no raw executor.")
+		}
+
+		w.raw = raw
+	}
+
+	if opts.Persist != "" {
+
+		persister, ok := target.(db.Persister)
+
+		if !ok {
+			return nil, errors.New("target has no persistence oracle.")
+		}
+
+		// DEBUG disabled, nothing to compare
+		_, err := persister.Digest()
+
+		if err != nil {
+			return nil, fmt.Errorf("persist needs DEBUG DIGEST. %v", err)
+		}
+
+		w.persist = opts.Persist
+		w.persister = persister
+	}
+
+	if opts.Repl {
+
+		replicator, ok := target.(db.Replicator)
+
+		if !ok {
+			return nil, errors.New("target has no replica.")
+		}
+
+		w.replicator = replicator
+	}
+
+	if opts.ConfigSet {
+
+		configurer, ok := target.(db.Configurer)
+
+		if !ok {
+			return nil, errors.New("target has no runtime config.")
+		}
+
+		configs, err := loadConfig(configurer)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(configs) == 0 {
+			return nil, errors.New("no mutable config.")
+		}
+
+		w.configs = configs
+	}
+
+	return w, nil
+}
+
+// private
+// one pipeline or one line, go-redis or raw resp, return what was executed
+func (self *worker) execute(group utils.CrashJson) (utils.TargetState, utils.CrashJson, error) {
+
+	if self.raw == nil {
+
+		state, err := db.ExecuteGroup(self.target, group)
+
+		return state, group, err
+	}
+
+	// raw lines are never grouped
+	_, args := utils.DecodeLine(group[0])
+
+	packets := utils.MutateRESP(self.rng, args)
+	state, err := self.raw.ExecuteRaw(packets)
+
+	return state, utils.CrashJson{utils.EncodeRawLine(packets)}, err
+}
+
+// private
+// mutate loop
+// new lines are saved by fuzzServer
+func (self *worker) run(corpus *model.Corpus) {
+
+	for {
+
+		// round-robin
+		self.profileRotate()
+
+		// sequence seed, recorded in header
+		self.seed = utils.NextSeed()
+		self.rng.Seed(self.seed)
+
+		// mutated line, corpus and flags go to header
+		self.opts = corpus.MutateOpts()
+		self.opts.Corpus = corpus.Len()
+		mutated := corpus.Mutate(self.seed, self.opts.Corpus)
+
+		// clean up database
+		err := self.target.CleanUp()
+
+		if err != nil {
+			log.Printf("worker %d clean up failed\n", self.id)
+		}
+
+		// new coverage
+		interesting := false
+
+		// lines with client and pipeline
+		seq := make(utils.CrashJson, 0, len(mutated))
+
+		for _, line := range mutated {
+			seq = append(seq, line.Encode())
+		}
+
+		// executed lines
+		cj := make(utils.CrashJson, 0, len(mutated))
+
+		// seed and profile
+		cj = append(cj, self.header())
+
+		// sequence deadline
+		start := time.Now()
+
+		// crash or hang
+		aborted := false
+
+		// coverage reset and check
+		var covered time.Duration
+
+		// runtime config, half
+		applied := make([]configParam, 0)
+
+		if self.configs != nil && self.rng.Int(2) == 0 {
+			cj, applied, aborted = self.configApply(cj)
+		}
+
+	lineLoop:
+		for index := 0; index < len(seq) && !aborted; {
+
+			// pipeline [index, end), one exec like one line
+			end := utils.LineGroup(seq, index)
+			_, args := utils.DecodeLine(seq[index])
+
+			// execute
+			covStart := time.Now()
+			self.cov.Reset()
+			covered += time.Since(covStart)
+
+			state, executed, _ := self.execute(seq[index:end])
+			self.stats.Execs.Add(1)
+
+			cj = append(cj, executed...)
+
+			// too slow, target still answers
+			hang := HangUnresponsive
+
+			if state != utils.STATE_CRASH && state != utils.STATE_HANG && time.Since(start) > SequenceTimeout {
+				state = utils.STATE_HANG
+				hang = HangSlow
+			}
+
+			switch state {
+
+			case utils.STATE_OK:
+				self.stats.Oks.Add(1)
+
+			case utils.STATE_ERR:
+				self.stats.AddError(args[0])
+
+			// crash, hang
+			case utils.STATE_CRASH, utils.STATE_HANG:
+				self.fail(state, cj, len(cj)-1, hang)
+
+				aborted = true
+				break lineLoop
+			}
+
+			// new edges
+			covStart = time.Now()
+			newBits := self.cov.HasNewBits()
+			covered += time.Since(covStart)
+
+			if newBits {
+
+				for _, line := range mutated[index:end] {
+					line.Weight += model.LINE_SCORE_COVER
+				}
+
+				interesting = true
+			}
+
+			index = end
+		}
+
+		self.stats.ObserveCoverage(covered)
+
+		// save and load again
+		if !aborted && self.persister != nil {
+			self.persistCheck(cj)
+		}
+
+		// compare replica
+		if !aborted && self.replicator != nil {
+			self.replCheck(cj)
+		}
+
+		// target may still run, e.g. slow hang
+		self.configRestore(applied)
+
+		// keep sequence
+		if interesting {
+			corpus.AddLines(mutated)
+			self.stats.NewPath()
+		}
+
+		self.stats.Sequences.Add(1)
+	}
+}
+
+// private
+// @seed=n @profile=name @owner=n @corpus=n ..., first line of each crash
+func (self *worker) header() []string {
+
+	opts := self.opts
+	opts.Seed = self.seed
+
+	if self.profiles != nil {
+		opts.Profile = self.profiles[self.profile].Name
+	}
+
+	// cluster tag and placeholders
+	sharder, ok := self.target.(db.Sharder)
+
+	if ok {
+		opts.Owner = sharder.Owner()
+	}
+
+	return utils.EncodeLine(opts, nil)
+}
+
+// private
+// save crash or hang, count stats
+func (self *worker) fail(state utils.TargetState, cj utils.CrashJson, index int, hang string) {
+
+	switch state {
+
+	case utils.STATE_CRASH:
+		self.stats.Crashes.Add(1)
+		self.stats.Restarts.Add(1)
+
+		// first hit, new bucket
+		if fuzzCrash(self.target, cj, index) == 1 {
+			self.stats.Buckets.Add(1)
+		}
+
+	case utils.STATE_HANG:
+		self.stats.Hangs.Add(1)
+
+		if fuzzHang(self.target, cj, index, hang) == 1 {
+			self.stats.HangBuckets.Add(1)
+		}
+
+		if hang == HangUnresponsive {
+			self.stats.Restarts.Add(1)
+		}
+	}
+}
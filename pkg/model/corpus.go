@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"log"
 	"strings"
+	"sync"
 
 	"github.com/fuxxcss/redi2fuzz/pkg/utils"
 )
@@ -17,15 +18,40 @@ const (
 	CorpusPath string = "queue/corpus-json"
 )
 
+// type confusion percent
+const (
+	CORPUS_CONFUSION int = 10
+)
+
 // corpus len
 const (
 	CORPUS_MINLEN int = 15
 	CORPUS_MAXLEN int = 45
 )
 
+// shared by workers
 type Corpus struct {
+	mu     sync.Mutex
 	weight int64
 	order   []*Line
+	// lines added since Save
+	dirty  bool
+
+	// target seps
+	lineSep  string
+	tokenSep string
+
+	// command grammar, may be nil
+	schema   Schema
+
+	// type confusion percent
+	confusion int
+
+	// transactions, watch, pipelines
+	sequence  bool
+
+	// EVAL and FCALL of lines
+	script    bool
 }
 
 /*
@@ -33,22 +59,92 @@ type Corpus struct {
  */
 
 // public
-func NewCorpus() *Corpus {
+func NewCorpus(lineSep, tokenSep string) *Corpus {
 
 	corpus := new(Corpus)
 	corpus.weight = 0
 	corpus.order = make([]*Line, 0)
+	corpus.lineSep = lineSep
+	corpus.tokenSep = tokenSep
+	corpus.confusion = CORPUS_CONFUSION
 
 	return corpus
 }
 
+// public
+func (self *Corpus) SetSchema(schema Schema) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.schema = schema
+}
+
+// public
+func (self *Corpus) SetConfusion(confusion int) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.confusion = confusion
+}
+
+// public
+// target runs pipelines and a second connection
+func (self *Corpus) SetSequence(sequence bool) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.sequence = sequence
+}
+
+// public
+// target runs lua scripts and functions
+func (self *Corpus) SetScript(script bool) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.script = script
+}
+
+// public
+// mutation flags, recorded in crash header
+func (self *Corpus) MutateOpts() utils.LineOpts {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return utils.LineOpts{
+		Sequence:  self.sequence,
+		Script:    self.script,
+		Confusion: self.confusion,
+	}
+}
+
+// public
+// flags of a crash header, see Mutate
+func (self *Corpus) SetMutateOpts(opts utils.LineOpts) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.sequence = opts.Sequence
+	self.script = opts.Script
+	self.confusion = opts.Confusion
+}
+
 // public
 func (self *Corpus) AddFile(file string) []*Line {
 
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	ret := make([]*Line, 0)
 
 	// split line
-	lines := strings.Split(file, LineSep)
+	lines := strings.Split(file, self.lineSep)
 
 	for _, line := range lines {
 
@@ -57,7 +153,7 @@ func (self *Corpus) AddFile(file string) []*Line {
 		hash := string(sum[:])
 
 		// new line
-		new := NewLine(line, hash)
+		new := NewLine(line, hash, self.tokenSep)
 
 		self.order = append(self.order, new)
 		ret = append(ret, new)
@@ -66,7 +162,78 @@ func (self *Corpus) AddFile(file string) []*Line {
 	return ret
 }
 
-func (self *Corpus) Mutate() []*Line {
+// public
+// keep interesting lines, e.g. new coverage
+func (self *Corpus) AddLines(lines []*Line) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	for _, line := range lines {
+
+		// new coverage of a wrapper belongs to the lines it wraps
+		if line.wrapper {
+			continue
+		}
+
+		self.order = append(self.order, line)
+
+		// corpus weight is lazy, see Select
+		if self.weight != 0 {
+			self.weight += line.Weight
+		}
+	}
+
+	self.dirty = true
+}
+
+// public
+// lines added since Save
+func (self *Corpus) Dirty() bool {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.dirty
+}
+
+// public
+func (self *Corpus) Len() int {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return len(self.order)
+}
+
+// public
+// sum of line weights
+func (self *Corpus) Weight() int64 {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var weight int64 = 0
+
+	for _, line := range self.order {
+		weight += line.Weight
+	}
+
+	return weight
+}
+
+// public
+// lines of the first n only, same seed and n, same lines
+func (self *Corpus) Mutate(seed uint64, n int) []*Line {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	utils.SeedMutate(seed)
+
+	// lines added later are never selected
+	order := self.order[:min(n, len(self.order))]
+	weight := self.prefixWeight(len(order))
 
 	// mutated len
 	length := utils.RandInt(CORPUS_MAXLEN-CORPUS_MINLEN) + CORPUS_MINLEN
@@ -76,14 +243,17 @@ func (self *Corpus) Mutate() []*Line {
 	for i := 0; i < length; {
 
 		// select one line
-		line := self.Select()
+		selected := selectLine(order, weight)
 
-		if line == nil {
+		if selected == nil {
 			continue
 		}
 
+		// keep corpus line untouched
+		line := selected.Clone()
+
 		// repair line
-		isRepaired := line.Repair(ret)
+		isRepaired := line.Repair(ret, self.confusion)
 
 		if !isRepaired {
 			continue
@@ -91,18 +261,44 @@ func (self *Corpus) Mutate() []*Line {
 
 		// mutate line
 		line.Mutate()
+
+		// mutate arguments, half
+		if self.schema != nil && utils.RandInt(2) == 0 {
+			line.MutateGrammar(self.schema)
+		}
+
 		ret = append(ret, line)
 
 		// one line is ready
 		i ++
 	}
 
+	// lines into a script, quarter
+	if self.script && utils.RandInt(4) == 0 {
+		ret = MutateScript(ret)
+	}
+
+	// mutate sequence, half
+	if self.sequence && utils.RandInt(2) == 0 {
+		ret = MutateSequence(ret)
+	}
+
 	return ret
 }
 
 // public
 func (self *Corpus) Select() *Line {
 
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return selectLine(self.order, self.prefixWeight(len(self.order)))
+}
+
+// private
+// weight of the first n lines
+func (self *Corpus) prefixWeight(n int) int64 {
+
 	// init corpus weight
 	if self.weight == 0 {
 		for _, line := range self.order {
@@ -110,12 +306,28 @@ func (self *Corpus) Select() *Line {
 		}
 	}
 
+	if n == len(self.order) {
+		return self.weight
+	}
+
+	var weight int64 = 0
+
+	for _, line := range self.order[:n] {
+		weight += line.Weight
+	}
+
+	return weight
+}
+
+// private
+func selectLine(order []*Line, weight int64) *Line {
+
 	// roulette wheel selection
-	rand := utils.RandFloat() * float64(self.weight)
+	rand := utils.RandFloat() * float64(weight)
 	var sum int64 = 0
 
 	// select line
-	for _, line := range self.order {
+	for _, line := range order {
 
 		sum += line.Weight
 
@@ -130,6 +342,9 @@ func (self *Corpus) Select() *Line {
 // debug
 func (self *Corpus) Debug() {
 
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
 	log.Printf("Corpus Num: %d\n", len(self.order))
 
 	for _, line := range self.order {
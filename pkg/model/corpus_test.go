@@ -0,0 +1,69 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mutateTexts(corpus *Corpus, seed uint64, n int) [][]string {
+
+	texts := make([][]string, 0)
+
+	for _, line := range corpus.Mutate(seed, n) {
+		texts = append(texts, line.Text())
+	}
+
+	return texts
+}
+
+func TestCorpusMutatePrefix(t *testing.T) {
+
+	corpus := testCorpus(t)
+	n := corpus.Len()
+
+	first := mutateTexts(corpus, 42, n)
+
+	if len(first) < CORPUS_MINLEN {
+		t.Fatalf("%d lines", len(first))
+	}
+
+	// lines added later are never selected, even heavy ones
+	added := []*Line{NewLine("SET k v", "", " "), NewLine("LPUSH l a", "", " ")}
+
+	for _, line := range added {
+		line.Weight = 100 * LINE_SCORE_COVER
+	}
+
+	corpus.AddLines(added)
+
+	if got := mutateTexts(corpus, 42, n); !reflect.DeepEqual(got, first) {
+		t.Errorf("%q, want %q", got, first)
+	}
+
+	for _, text := range first {
+
+		if text[0] != "HSET" && text[0] != "HGET" {
+			t.Errorf("%q selected", text)
+		}
+	}
+}
+
+func TestCorpusMutateOpts(t *testing.T) {
+
+	corpus := NewCorpus("\n", " ")
+	corpus.SetSequence(true)
+	corpus.SetConfusion(30)
+
+	opts := corpus.MutateOpts()
+
+	if !opts.Sequence || opts.Script || opts.Confusion != 30 {
+		t.Fatalf("%+v", opts)
+	}
+
+	other := NewCorpus("\n", " ")
+	other.SetMutateOpts(opts)
+
+	if other.MutateOpts() != opts {
+		t.Errorf("%+v, want %+v", other.MutateOpts(), opts)
+	}
+}
@@ -0,0 +1,315 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+/*
+ * Corpus Json Definition
+ */
+
+// corpus json format
+const (
+	CorpusFile    string = "corpus.json"
+	CorpusVersion int    = 1
+)
+
+type CorpusJson struct {
+	Version int        `json:"version"`
+	Lines   []LineJson `json:"lines"`
+}
+
+type LineJson struct {
+	Weight   int64        `json:"weight"`
+	Tokens   []Token      `json:"tokens"`
+	Vertices []VertexJson `json:"vertices"`
+	Prev     []int        `json:"prev"`
+	Next     []int        `json:"next"`
+}
+
+// vertex refers to line token by index
+// token out of line is kept in Data
+type VertexJson struct {
+	Token int    `json:"token"`
+	Data  *Token `json:"data,omitempty"`
+	Prev  int    `json:"prev"`
+	Next  []int  `json:"next"`
+}
+
+/*
+ * Corpus Json Functions
+ */
+
+// public
+// lines are never changed after AddLines, encode outside the lock
+func (self *Corpus) Save(dir string) error {
+
+	self.mu.Lock()
+	order := slices.Clone(self.order)
+	self.dirty = false
+	self.mu.Unlock()
+
+	cj := CorpusJson{
+		Version: CorpusVersion,
+		Lines:   make([]LineJson, 0, len(order)),
+	}
+
+	for _, line := range order {
+		cj.Lines = append(cj.Lines, line.toJson())
+	}
+
+	bytes, err := json.Marshal(&cj)
+
+	if err != nil {
+		self.setDirty()
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+
+	if err != nil {
+		self.setDirty()
+		return err
+	}
+
+	// write tmp, then rename
+	path := filepath.Join(dir, CorpusFile)
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, bytes, 0664)
+
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	// try again next time
+	if err != nil {
+		self.setDirty()
+	}
+
+	return err
+}
+
+// private
+func (self *Corpus) setDirty() {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.dirty = true
+}
+
+// public
+func LoadCorpus(dir, lineSep, tokenSep string) (*Corpus, error) {
+
+	path := filepath.Join(dir, CorpusFile)
+	bytes, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cj CorpusJson
+	err = json.Unmarshal(bytes, &cj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// version mismatch
+	if cj.Version != CorpusVersion {
+		return nil, fmt.Errorf("corpus version %d, want %d.", cj.Version, CorpusVersion)
+	}
+
+	corpus := NewCorpus(lineSep, tokenSep)
+
+	for _, lj := range cj.Lines {
+
+		line, err := lineFromJson(&lj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		corpus.order = append(corpus.order, line)
+	}
+
+	return corpus, nil
+}
+
+// private
+func (self *Line) toJson() LineJson {
+
+	lj := LineJson{
+		Weight:   self.Weight,
+		Tokens:   make([]Token, 0, len(self.tokens)),
+		Vertices: make([]VertexJson, 0),
+		Prev:     make([]int, 0, len(self.graph.prev)),
+		Next:     make([]int, 0, len(self.graph.next)),
+	}
+
+	// token -> index
+	tokenIndex := make(map[*Token]int, len(self.tokens))
+
+	for i, token := range self.tokens {
+		tokenIndex[token] = i
+		lj.Tokens = append(lj.Tokens, *token)
+	}
+
+	// vertex -> index
+	vertexIndex := make(map[*Vertex]int, 0)
+
+	var indexVertex func(*Vertex) int
+
+	indexVertex = func(vertex *Vertex) int {
+
+		if vertex == nil {
+			return -1
+		}
+
+		index, ok := vertexIndex[vertex]
+
+		if ok {
+			return index
+		}
+
+		// reserve index first, graph may loop
+		index = len(lj.Vertices)
+		vertexIndex[vertex] = index
+		lj.Vertices = append(lj.Vertices, VertexJson{})
+
+		vj := VertexJson{
+			Token: -1,
+			Next:  make([]int, 0, len(vertex.next)),
+		}
+
+		ti, ok := tokenIndex[vertex.data]
+
+		if ok {
+			vj.Token = ti
+		} else {
+			data := *vertex.data
+			vj.Data = &data
+		}
+
+		vj.Prev = indexVertex(vertex.prev)
+
+		for _, next := range vertex.next {
+			vj.Next = append(vj.Next, indexVertex(next))
+		}
+
+		lj.Vertices[index] = vj
+
+		return index
+	}
+
+	for _, prev := range self.graph.prev {
+		lj.Prev = append(lj.Prev, indexVertex(prev))
+	}
+
+	for _, next := range self.graph.next {
+		lj.Next = append(lj.Next, indexVertex(next))
+	}
+
+	return lj
+}
+
+// private
+func lineFromJson(lj *LineJson) (*Line, error) {
+
+	line := new(Line)
+	line.Weight = lj.Weight
+	line.graph = NewGraph()
+	line.tokens = make([]*Token, 0, len(lj.Tokens))
+
+	for _, token := range lj.Tokens {
+
+		newToken := new(Token)
+		*newToken = token
+		line.tokens = append(line.tokens, newToken)
+	}
+
+	// vertices first, edges later
+	vertices := make([]*Vertex, len(lj.Vertices))
+
+	for i, vj := range lj.Vertices {
+
+		var data *Token
+
+		switch {
+		case vj.Token >= 0 && vj.Token < len(line.tokens):
+			data = line.tokens[vj.Token]
+		case vj.Token == -1 && vj.Data != nil:
+			data = new(Token)
+			*data = *vj.Data
+		default:
+			return nil, errors.New("vertex token out of range.")
+		}
+
+		vertices[i] = line.graph.AddVertex(data)
+	}
+
+	// index -> vertex
+	vertexAt := func(index int) (*Vertex, error) {
+
+		if index < 0 || index >= len(vertices) {
+			return nil, errors.New("vertex index out of range.")
+		}
+
+		return vertices[index], nil
+	}
+
+	for i, vj := range lj.Vertices {
+
+		if vj.Prev >= 0 {
+
+			prev, err := vertexAt(vj.Prev)
+
+			if err != nil {
+				return nil, err
+			}
+
+			vertices[i].prev = prev
+		}
+
+		for _, index := range vj.Next {
+
+			next, err := vertexAt(index)
+
+			if err != nil {
+				return nil, err
+			}
+
+			vertices[i].next = append(vertices[i].next, next)
+		}
+	}
+
+	for _, index := range lj.Prev {
+
+		prev, err := vertexAt(index)
+
+		if err != nil {
+			return nil, err
+		}
+
+		line.graph.prev = append(line.graph.prev, prev)
+	}
+
+	for _, index := range lj.Next {
+
+		next, err := vertexAt(index)
+
+		if err != nil {
+			return nil, err
+		}
+
+		line.graph.next = append(line.graph.next, next)
+	}
+
+	return line, nil
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// hset creates h -> f, hget keeps them
+func testCorpus(t *testing.T) *Corpus {
+
+	key := Token{Level: TOKEN_LEVEL_1, Text: "h", Type: "hash"}
+	field := Token{Level: TOKEN_LEVEL_2, Text: "f"}
+	snapshot := Snapshot{key: {field}}
+
+	hset := NewLine("HSET h f v", "", " ")
+
+	if err := hset.Build(NewSnapshot(), snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	hget := NewLine("HGET h f", "", " ")
+
+	if err := hget.Build(Snapshot{key: {field}}, Snapshot{key: {field}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// graph must be saved too
+	if len(hset.graph.next) == 0 || len(hget.graph.prev) == 0 {
+		t.Fatal("lines have no graph")
+	}
+
+	corpus := NewCorpus("\n", " ")
+	corpus.AddLines([]*Line{hset, hget})
+
+	return corpus
+}
+
+func TestCorpusRoundTrip(t *testing.T) {
+
+	dir := t.TempDir()
+	corpus := testCorpus(t)
+
+	if !corpus.Dirty() {
+		t.Fatal("corpus not dirty after AddLines")
+	}
+
+	if err := corpus.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if corpus.Dirty() {
+		t.Fatal("corpus dirty after Save")
+	}
+
+	loaded, err := LoadCorpus(dir, "\n", " ")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != corpus.Len() {
+		t.Fatalf("len %d, want %d", loaded.Len(), corpus.Len())
+	}
+
+	for i, line := range corpus.order {
+
+		got := loaded.order[i]
+
+		if !reflect.DeepEqual(got.toJson(), line.toJson()) {
+			t.Errorf("line %d: %+v, want %+v", i, got.toJson(), line.toJson())
+		}
+
+		if !reflect.DeepEqual(got.Text(), line.Text()) {
+			t.Errorf("line %d: %v, want %v", i, got.Text(), line.Text())
+		}
+	}
+}
+
+func TestCorpusVersion(t *testing.T) {
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, CorpusFile), []byte(`{"version":0,"lines":[]}`), 0664)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadCorpus(dir, "\n", " ")
+
+	if err == nil {
+		t.Fatal("old corpus version loaded")
+	}
+}
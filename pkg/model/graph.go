@@ -2,6 +2,10 @@ package model
 
 import (
 	"log"
+	"maps"
+	"slices"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
 )
 
 // graph = level 0
@@ -36,12 +40,64 @@ func (self *Graph) AddVertex(data *Token) *Vertex{
 	return vertex
 }
 
-// public
-func (self *Graph) Match(graph *Graph) bool {
+// private
+func (self *Graph) clone(tokenMap map[*Token]*Token) *Graph {
+
+	graph := NewGraph()
+
+	// old vertex -> new vertex
+	vertexMap := make(map[*Vertex]*Vertex, 0)
+
+	var cloneVertex func(*Vertex) *Vertex
+
+	cloneVertex = func(old *Vertex) *Vertex {
+
+		if old == nil {
+			return nil
+		}
+
+		vertex, ok := vertexMap[old]
+
+		if ok {
+			return vertex
+		}
+
+		data, ok := tokenMap[old.data]
+
+		// token out of line
+		if !ok {
+			data = new(Token)
+			*data = *old.data
+			tokenMap[old.data] = data
+		}
+
+		vertex = graph.AddVertex(data)
+		vertexMap[old] = vertex
+
+		vertex.prev = cloneVertex(old.prev)
+
+		for _, next := range old.next {
+			vertex.next = append(vertex.next, cloneVertex(next))
+		}
+
+		return vertex
+	}
+
+	for _, prev := range self.prev {
+		graph.prev = append(graph.prev, cloneVertex(prev))
+	}
+
+	for _, next := range self.next {
+		graph.next = append(graph.next, cloneVertex(next))
+	}
+
+	return graph
+}
 
-	// token level num
-	matchNum := make(map[TokenLevel]int, 0)
-	hasNum := make(map[TokenLevel]int, 0)
+// public
+// bind self prev tokens to graph next tokens of the same level,
+// same type first, another type in confusion percent
+func (self *Graph) Match(graph *Graph, confusion int) bool {
 
 	// token level slice
 	matchSlice := make(map[TokenLevel][]*Token, 0)
@@ -50,57 +106,75 @@ func (self *Graph) Match(graph *Graph) bool {
 	// to match
 	for _, prev := range self.prev {
 
-		// update match
 		level := prev.data.Level
-		_, ok := matchNum[level]
-
-		if ok {
-			matchNum[level] ++
-			matchSlice[level] = append(matchSlice[level], prev.data)
-		}else {
-			matchNum[level] = 1
-			matchSlice[level] = make([]*Token, 0)
-		}
-
+		matchSlice[level] = append(matchSlice[level], prev.data)
 	}
 
 	// graph has
 	for _, next := range graph.next {
 
-		// update has
 		level := next.data.Level
-		_, ok := hasNum[level]
-
-		if ok {
-			hasNum[level] ++
-			hasSlice[level] = append(hasSlice[level], next.data)
-		}else {
-			hasNum[level] = 1
-			hasSlice[level] = make([]*Token, 0)
-		}
-
+		hasSlice[level] = append(hasSlice[level], next.data)
 	}
 
+	// fixed order, same seed same binding
+	levels := slices.Sorted(maps.Keys(matchSlice))
+
 	// cannot match
-	for level, num := range matchNum {
+	for _, level := range levels {
+
+		slice := matchSlice[level]
 
-		if hasNum[level] < num {
+		if len(hasSlice[level]) < len(slice) {
 			return false
 		}
 	}
 
 	// match self -> graph
-	for level, slice := range matchSlice {
+	for _, level := range levels {
+
+		slice := matchSlice[level]
 
-		// match tokens
-		for index, token := range slice {
-			token.Text = hasSlice[level][index].Text
+		// each graph token once
+		has := slices.Clone(hasSlice[level])
+
+		for _, token := range slice {
+
+			index := matchType(token, has, confusion)
+			token.Text = has[index].Text
+			token.Type = has[index].Type
+
+			has = slices.Delete(has, index, index+1)
 		}
 	}
 
 	return true
 }
 
+// private
+func matchType(token *Token, has []*Token, confusion int) int {
+
+	// type confusion
+	if token.Type == "" || utils.RandInt(100) < confusion {
+		return utils.RandInt(len(has))
+	}
+
+	same := make([]int, 0)
+
+	for i, t := range has {
+		if t.Type == token.Type {
+			same = append(same, i)
+		}
+	}
+
+	// no same type
+	if len(same) == 0 {
+		return utils.RandInt(len(has))
+	}
+
+	return same[utils.RandInt(len(same))]
+}
+
 // debug
 func (self *Graph) Debug() {
 
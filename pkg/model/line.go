@@ -9,10 +9,6 @@ import (
 	"github.com/fuxxcss/redi2fuzz/pkg/utils"
 )
 
-// global
-var LineSep string
-var TokenSep string
-
 // token level
 type TokenLevel int
 
@@ -33,25 +29,33 @@ const (
 	LINE_SCORE_CREATE int64 = 2
 	LINE_SCORE_DELETE int64 = 2
 	LINE_SCORE_KEEP   int64 = 1
+	LINE_SCORE_COVER  int64 = 4
 )
 
 type Line struct {
 
 	// public
 	Weight int64
+	// sequence only, see MutateSequence
+	Client int
+	Pipe   int
 
 	// private
 	graph  *Graph
 	tokens []*Token
+	// MULTI, WATCH, script ... of one sequence, see newSeqLine
+	wrapper bool
 }
 
 type Token struct {
-	Level TokenLevel
-	Text  string
+	Level TokenLevel `json:"level"`
+	Text  string     `json:"text"`
+	// TYPE of key, members share it
+	Type  string     `json:"type,omitempty"`
 }
 
 // public
-func NewLine(str, hash string) *Line {
+func NewLine(str, hash, tokenSep string) *Line {
 
 	Line := new(Line)
 
@@ -60,7 +64,7 @@ func NewLine(str, hash string) *Line {
 	Line.Weight = 0
 
 	// split tokens
-	tokens := strings.Split(str, TokenSep)
+	tokens := strings.Split(str, tokenSep)
 
 	for _, token := range tokens {
 
@@ -98,10 +102,8 @@ func NewLine(str, hash string) *Line {
 }
 
 // build model, graph
-// update Weight, snapshot
-func (self *Line) Build(new Snapshot) error {
-
-	old := oldSnapshot
+// update Weight, old snapshot is consumed
+func (self *Line) Build(old, new Snapshot) error {
 
 	// loop create, keep
 	for from, toSlice := range new {
@@ -119,6 +121,7 @@ func (self *Line) Build(new Snapshot) error {
 			}
 
 			fromToken.Level = from.Level
+			fromToken.Type = from.Type
 
 			// from vertex
 			fromVertex = self.graph.AddVertex(fromToken)
@@ -140,6 +143,7 @@ func (self *Line) Build(new Snapshot) error {
 			}
 
 			fromToken.Level = from.Level
+			fromToken.Type = from.Type
 
 			// from vertex
 			fromVertex = self.graph.AddVertex(fromToken)
@@ -159,11 +163,13 @@ func (self *Line) Build(new Snapshot) error {
 				// to token
 				toToken := self.Contains(&to)
 
+				// moved member, numeric member ...
 				if toToken == nil {
-					return errors.New("Create toToken Nil.")
+					continue
 				}
 
 				toToken.Level = to.Level
+				toToken.Type = to.Type
 
 				// to vertex
 				toVertex := self.graph.AddVertex(toToken)
@@ -190,6 +196,7 @@ func (self *Line) Build(new Snapshot) error {
 				}
 
 				toToken.Level = to.Level
+				toToken.Type = to.Type
 
 				// to vertex
 				toVertex := self.graph.AddVertex(toToken)
@@ -221,6 +228,7 @@ func (self *Line) Build(new Snapshot) error {
 		}
 
 		fromToken.Level = from.Level
+		fromToken.Type = from.Type
 
 		// from vertex
 		fromVertex := self.graph.AddVertex(fromToken)
@@ -241,6 +249,7 @@ func (self *Line) Build(new Snapshot) error {
 			}
 
 			toToken.Level = to.Level
+			toToken.Type = to.Type
 
 			// to vertex
 			toVertex := self.graph.AddVertex(toToken)
@@ -255,14 +264,12 @@ func (self *Line) Build(new Snapshot) error {
 		}
 	}
 
-	// update snapshot
-	oldSnapshot = new
-
 	return nil
 }
 
 // public
-func (self *Line) Repair(lines []*Line) bool {
+// confusion: percent of binding a key of another type
+func (self *Line) Repair(lines []*Line, confusion int) bool {
 
 	if len(self.graph.prev) == 0 {
 		return true
@@ -272,7 +279,7 @@ func (self *Line) Repair(lines []*Line) bool {
 	for _, line := range lines {
 
 		// match succeed
-		if self.graph.Match(line.graph) {
+		if self.graph.Match(line.graph, confusion) {
 			return true
 		}
 	}
@@ -332,6 +339,31 @@ func MutateStr(str string) string {
 
 }
 
+// public
+// deep copy tokens and graph, mutate without touching corpus
+func (self *Line) Clone() *Line {
+
+	line := new(Line)
+	line.Weight = self.Weight
+	line.tokens = make([]*Token, 0, len(self.tokens))
+
+	// old token -> new token
+	tokenMap := make(map[*Token]*Token, len(self.tokens))
+
+	for _, token := range self.tokens {
+
+		newToken := new(Token)
+		*newToken = *token
+
+		tokenMap[token] = newToken
+		line.tokens = append(line.tokens, newToken)
+	}
+
+	line.graph = self.graph.clone(tokenMap)
+
+	return line
+}
+
 // public
 func (self *Line) Text() []string {
 
@@ -344,6 +376,34 @@ func (self *Line) Text() []string {
 	return ret
 }
 
+// public
+// text with client and pipeline, see utils.EncodeLine
+func (self *Line) Encode() []string {
+
+	opts := utils.LineOpts{
+		Client: self.Client,
+		Pipe:   self.Pipe,
+	}
+
+	return utils.EncodeLine(opts, self.Text())
+}
+
+// public
+// key tokens, level 1
+func (self *Line) Keys() []string {
+
+	keys := make([]string, 0)
+
+	for _, token := range self.tokens {
+
+		if token.Level == TOKEN_LEVEL_1 {
+			keys = append(keys, token.Text)
+		}
+	}
+
+	return keys
+}
+
 // public
 func (self *Line) Contains(token *Token) *Token {
 
@@ -368,13 +428,7 @@ func (self *Line) Debug() {
 
 	log.Println("==== Line Debug ====")
 
-	var str string
-
-	texts := self.Text()
-
-	for _, text := range texts {
-		str += text + TokenSep
-	}
+	str := strings.Join(self.Text(), " ")
 
 	log.Printf("line: %s\n", str)
 	log.Printf("weight: %d\n", self.Weight)
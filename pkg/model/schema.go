@@ -0,0 +1,482 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Schema Definition
+ */
+
+// argument type, COMMAND DOCS
+const (
+	ARG_KEY      string = "key"
+	ARG_STRING   string = "string"
+	ARG_INTEGER  string = "integer"
+	ARG_DOUBLE   string = "double"
+	ARG_PATTERN  string = "pattern"
+	ARG_UNIXTIME string = "unix-time"
+	ARG_TOKEN    string = "pure-token"
+	ARG_ONEOF    string = "oneof"
+	ARG_BLOCK    string = "block"
+)
+
+// grammar mutation
+const (
+	GRAMMAR_ADD int = iota
+	GRAMMAR_DROP
+	GRAMMAR_SWAP
+	GRAMMAR_VALUE
+	GRAMMAR_MUTATIONS
+)
+
+type Arg struct {
+	Name     string
+	Type     string
+	// NX, LIMIT ...
+	Token    string
+	Optional bool
+	Multiple bool
+	Args     []*Arg
+
+	// oneof, block
+	parent   *Arg
+}
+
+type CommandSchema struct {
+	Name     string
+	Arity    int
+	// COMMAND INFO key positions
+	FirstKey int
+	LastKey  int
+	Step     int
+	Args     []*Arg
+}
+
+// "SET", "CONFIG|GET" ...
+type Schema map[string]*CommandSchema
+
+/*
+ * Schema Functions
+ */
+
+// public
+// link parents after args are built
+func (self *CommandSchema) Link() {
+
+	var link func(parent *Arg, args []*Arg)
+
+	link = func(parent *Arg, args []*Arg) {
+		for _, arg := range args {
+			arg.parent = parent
+			link(arg, arg.Args)
+		}
+	}
+
+	link(nil, self.Args)
+}
+
+// public
+// subcommand first, return schema and index of first arg
+func (self Schema) Lookup(texts []string) (*CommandSchema, int) {
+
+	if len(texts) == 0 {
+		return nil, 0
+	}
+
+	cmd := strings.ToUpper(texts[0])
+
+	if len(texts) > 1 {
+
+		sub, ok := self[cmd+"|"+strings.ToUpper(texts[1])]
+
+		if ok {
+			return sub, 2
+		}
+	}
+
+	cs, ok := self[cmd]
+
+	if !ok {
+		return nil, 0
+	}
+
+	return cs, 1
+}
+
+// public
+// best effort, arg of each text, nil if unknown
+func (self *CommandSchema) Match(texts []string, start int) []*Arg {
+
+	out := make([]*Arg, len(texts))
+	matchArgs(self.Args, texts, start, out)
+
+	return out
+}
+
+// public
+func (self *CommandSchema) IsKey(index, size int) bool {
+
+	if self.FirstKey <= 0 {
+		return false
+	}
+
+	// negative last key counts from end
+	last := self.LastKey
+
+	if last < 0 {
+		last = size + last
+	}
+
+	step := max(self.Step, 1)
+
+	for i := self.FirstKey; i <= last; i += step {
+		if i == index {
+			return true
+		}
+	}
+
+	return false
+}
+
+// private
+func matchArgs(args []*Arg, texts []string, i int, out []*Arg) int {
+
+	for _, arg := range args {
+
+		for {
+			j := matchArg(arg, texts, i, out)
+			matched := j > i
+			i = j
+
+			if !arg.Multiple || !matched {
+				break
+			}
+		}
+	}
+
+	return i
+}
+
+// private
+// return i if not matched
+func matchArg(arg *Arg, texts []string, i int, out []*Arg) int {
+
+	if i >= len(texts) {
+		return i
+	}
+
+	start := i
+
+	// keyword first
+	if arg.Token != "" {
+
+		if !strings.EqualFold(texts[i], arg.Token) {
+			return start
+		}
+
+		out[i] = arg
+		i++
+
+		if arg.Type == ARG_TOKEN {
+			return i
+		}
+
+		if i >= len(texts) {
+			return i
+		}
+	}
+
+	switch arg.Type {
+
+	case ARG_TOKEN:
+		if !strings.EqualFold(texts[i], arg.Name) {
+			return start
+		}
+
+		out[i] = arg
+		return i + 1
+
+	case ARG_ONEOF:
+		for _, alt := range arg.Args {
+
+			j := matchArg(alt, texts, i, out)
+
+			if j > i {
+				return j
+			}
+		}
+
+		return i
+
+	case ARG_BLOCK:
+		return matchArgs(arg.Args, texts, i, out)
+	}
+
+	// optional value must fit
+	if arg.Optional && arg.Token == "" && !fitType(arg.Type, texts[i]) {
+		return start
+	}
+
+	out[i] = arg
+
+	return i + 1
+}
+
+// private
+func fitType(argType, text string) bool {
+
+	switch argType {
+
+	case ARG_INTEGER, ARG_UNIXTIME:
+		_, err := strconv.ParseInt(text, 10, 64)
+		return err == nil
+
+	case ARG_DOUBLE:
+		_, err := strconv.ParseFloat(text, 64)
+		return err == nil
+	}
+
+	// keyword like text is not a value
+	return strings.ToUpper(text) != text
+}
+
+// private
+// keyword arg and values of its args
+func genArg(arg *Arg) []*Token {
+
+	ret := make([]*Token, 0)
+
+	if arg.Token != "" {
+		ret = append(ret, &Token{Level: TOKEN_LEVEL_0, Text: arg.Token})
+	}
+
+	switch arg.Type {
+
+	case ARG_TOKEN:
+		if arg.Token == "" {
+			ret = append(ret, &Token{Level: TOKEN_LEVEL_0, Text: strings.ToUpper(arg.Name)})
+		}
+
+	case ARG_ONEOF:
+		if len(arg.Args) > 0 {
+			alt := arg.Args[utils.RandInt(len(arg.Args))]
+			ret = append(ret, genArg(alt)...)
+		}
+
+	case ARG_BLOCK:
+		for _, child := range arg.Args {
+
+			// optional child, half
+			if child.Optional && utils.RandInt(2) == 0 {
+				continue
+			}
+
+			ret = append(ret, genArg(child)...)
+		}
+
+	default:
+		ret = append(ret, GenValue(arg.Type))
+	}
+
+	return ret
+}
+
+// public
+// typed value for one position
+func GenValue(argType string) *Token {
+
+	pick := func(slice []string) string {
+		return slice[utils.RandInt(len(slice))]
+	}
+
+	switch argType {
+
+	case ARG_INTEGER, ARG_UNIXTIME:
+		return &Token{Level: TOKEN_LEVEL_value, Text: pick(utils.InterestingInteger)}
+
+	case ARG_DOUBLE:
+		return &Token{Level: TOKEN_LEVEL_value, Text: pick(utils.InterestingDouble)}
+
+	case ARG_PATTERN:
+		return &Token{Level: TOKEN_LEVEL_str, Text: pick(utils.InterestingPattern)}
+
+	// not in graph, plain string
+	case ARG_KEY:
+		return &Token{Level: TOKEN_LEVEL_str, Text: "key"}
+	}
+
+	return &Token{Level: TOKEN_LEVEL_str, Text: MutateStr("v")}
+}
+
+// public
+// add, drop, swap options or retype one value
+func (self *Line) MutateGrammar(schema Schema) {
+
+	texts := self.Text()
+	cs, start := schema.Lookup(texts)
+
+	if cs == nil {
+		return
+	}
+
+	out := cs.Match(texts, start)
+
+	switch utils.RandInt(GRAMMAR_MUTATIONS) {
+
+	case GRAMMAR_ADD:
+		self.addOption(cs)
+
+	case GRAMMAR_DROP:
+		self.dropOption(out)
+
+	case GRAMMAR_SWAP:
+		self.swapOption(out)
+
+	case GRAMMAR_VALUE:
+		self.typedValue(cs, out)
+	}
+}
+
+// private
+// append one optional keyword arg, e.g. NX, LIMIT 0 1
+func (self *Line) addOption(cs *CommandSchema) {
+
+	options := make([]*Arg, 0)
+
+	for _, arg := range cs.Args {
+
+		if !arg.Optional {
+			continue
+		}
+
+		options = append(options, arg)
+	}
+
+	if len(options) == 0 {
+		return
+	}
+
+	option := options[utils.RandInt(len(options))]
+	self.tokens = append(self.tokens, genArg(option)...)
+}
+
+// private
+// remove one keyword and its values
+func (self *Line) dropOption(out []*Arg) {
+
+	keywords := make([]int, 0)
+
+	for i, arg := range out {
+		if arg != nil && arg.Token != "" && strings.EqualFold(self.tokens[i].Text, arg.Token) {
+			keywords = append(keywords, i)
+		}
+	}
+
+	if len(keywords) == 0 {
+		return
+	}
+
+	i := keywords[utils.RandInt(len(keywords))]
+	keyword := out[i]
+
+	// values of keyword
+	end := i + 1
+
+	for end < len(out) && out[end] != nil {
+
+		// EX 10, value shares the keyword arg
+		value := out[end] == keyword && !strings.EqualFold(self.tokens[end].Text, keyword.Token)
+
+		if !value && !isChild(out[end], keyword) {
+			break
+		}
+
+		end++
+	}
+
+	self.tokens = append(self.tokens[:i], self.tokens[end:]...)
+}
+
+// private
+// NX <-> XX, BYSCORE <-> BYLEX ...
+func (self *Line) swapOption(out []*Arg) {
+
+	swaps := make([]int, 0)
+
+	for i, arg := range out {
+
+		if arg == nil || arg.Type != ARG_TOKEN || arg.parent == nil || arg.parent.Type != ARG_ONEOF {
+			continue
+		}
+
+		swaps = append(swaps, i)
+	}
+
+	if len(swaps) == 0 {
+		return
+	}
+
+	i := swaps[utils.RandInt(len(swaps))]
+	alts := out[i].parent.Args
+	alt := alts[utils.RandInt(len(alts))]
+
+	text := alt.Token
+
+	if text == "" {
+		text = strings.ToUpper(alt.Name)
+	}
+
+	self.tokens[i].Text = text
+}
+
+// private
+// new value fits position type, keys are left to graph
+func (self *Line) typedValue(cs *CommandSchema, out []*Arg) {
+
+	values := make([]int, 0)
+
+	for i, arg := range out {
+
+		if arg == nil || cs.IsKey(i, len(out)) {
+			continue
+		}
+
+		switch arg.Type {
+		case ARG_KEY, ARG_TOKEN, ARG_ONEOF, ARG_BLOCK:
+			continue
+		}
+
+		// keyword of a typed arg
+		if arg.Token != "" && strings.EqualFold(self.tokens[i].Text, arg.Token) {
+			continue
+		}
+
+		values = append(values, i)
+	}
+
+	if len(values) == 0 {
+		return
+	}
+
+	i := values[utils.RandInt(len(values))]
+	value := GenValue(out[i].Type)
+
+	self.tokens[i].Level = value.Level
+	self.tokens[i].Text = value.Text
+}
+
+// private
+func isChild(arg, parent *Arg) bool {
+
+	for p := arg.parent; p != nil; p = p.parent {
+		if p == parent {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Script Definition
+ */
+
+// script mutation
+const (
+	SCRIPT_EVAL int = iota
+	SCRIPT_FCALL
+	SCRIPT_MUTATIONS
+)
+
+// lines per script
+const (
+	SCRIPT_MAXLINES int = 4
+)
+
+// FUNCTION LOAD REPLACE, one library per sequence
+const (
+	ScriptLibrary  string = "r2f"
+	ScriptFunction string = "r2f_call"
+)
+
+// redis.call, redis.pcall, error table raised to lua pcall
+const (
+	SCRIPT_CALL int = iota
+	SCRIPT_PCALL
+	SCRIPT_LUA_PCALL
+	SCRIPT_CALLS
+)
+
+// lua types redis.call rejects or converts
+var luaValues = []string{
+	"nil",
+	"true",
+	"false",
+	"{}",
+	"{1, {2, {3}}}",
+	"9007199254740993",
+	"-9223372036854775808",
+	"1e308",
+	"-0.0",
+	"0/0",
+	"math.huge",
+	"string.rep('a', 65536)",
+	"redis.error_reply('r2f')",
+	"redis.status_reply('r2f')",
+	"{err = {err = 'r2f'}}",
+}
+
+// script reply, r holds call results
+var luaReturns = []string{
+	"r",
+	"{r, {r}}",
+	"{1, nil, r}",
+	"{err = 'r2f'}",
+	"{ok = 'r2f'}",
+	"{{err = 'r2f'}, {ok = 'r2f'}}",
+	"redis.error_reply('r2f')",
+	"9007199254740993",
+	"3.14",
+	"true",
+	"false",
+	"nil",
+}
+
+/*
+ * Script Functions
+ */
+
+// public
+// span of lines into one EVAL, or FUNCTION LOAD + FCALL
+// keys go through KEYS[]
+func MutateScript(lines []*Line) []*Line {
+
+	if len(lines) == 0 {
+		return lines
+	}
+
+	// span [start, end)
+	start := utils.RandInt(len(lines))
+	end := min(start+1+utils.RandInt(SCRIPT_MAXLINES), len(lines))
+
+	keys := make([]string, 0)
+	index := make(map[string]int, 0)
+
+	// KEYS[n], lua is 1-based
+	for _, line := range lines[start:end] {
+
+		for _, key := range line.Keys() {
+
+			_, ok := index[key]
+
+			if !ok {
+				keys = append(keys, key)
+				index[key] = len(keys)
+			}
+		}
+	}
+
+	var script []*Line
+
+	switch utils.RandInt(SCRIPT_MUTATIONS) {
+
+	case SCRIPT_EVAL:
+		body := luaBody(lines[start:end], index, "KEYS")
+		script = []*Line{scriptLine(keys, "EVAL", body)}
+
+	case SCRIPT_FCALL:
+		body := luaBody(lines[start:end], index, "keys")
+		script = []*Line{
+			newSeqLine("FUNCTION", "LOAD", "REPLACE", luaLibrary(body)),
+			scriptLine(keys, "FCALL", ScriptFunction),
+		}
+	}
+
+	ret := make([]*Line, 0, len(lines)+len(script))
+	ret = append(ret, lines[:start]...)
+	ret = append(ret, script...)
+
+	return append(ret, lines[end:]...)
+}
+
+// private
+// EVAL script numkeys key ..., keys stay level 1
+func scriptLine(keys []string, cmd, script string) *Line {
+
+	line := newSeqLine(cmd, script)
+	line.tokens = append(line.tokens, &Token{Level: TOKEN_LEVEL_value, Text: strconv.Itoa(len(keys))})
+
+	for _, key := range keys {
+		line.tokens = append(line.tokens, &Token{Level: TOKEN_LEVEL_1, Text: key})
+	}
+
+	return line
+}
+
+// private
+// one call per line, results in r
+func luaBody(lines []*Line, index map[string]int, keysVar string) string {
+
+	body := "local r = {} "
+
+	for i, line := range lines {
+
+		args := make([]string, 0, len(line.tokens))
+
+		for j, token := range line.tokens {
+
+			n, isKey := index[token.Text]
+
+			switch {
+
+			// cmd
+			case j == 0:
+				args = append(args, luaQuote(token.Text))
+
+			case isKey && token.Level == TOKEN_LEVEL_1:
+				args = append(args, fmt.Sprintf("%s[%d]", keysVar, n))
+
+			// lua type
+			case token.Level == TOKEN_LEVEL_value && utils.RandInt(4) == 0:
+				args = append(args, luaValues[utils.RandInt(len(luaValues))])
+
+			default:
+				args = append(args, luaQuote(token.Text))
+			}
+		}
+
+		call := strings.Join(args, ", ")
+
+		switch utils.RandInt(SCRIPT_CALLS) {
+
+		case SCRIPT_CALL:
+			call = "redis.call(" + call + ")"
+
+		case SCRIPT_PCALL:
+			call = "redis.pcall(" + call + ")"
+
+		case SCRIPT_LUA_PCALL:
+			call = "{pcall(redis.call, " + call + ")}"
+		}
+
+		body += fmt.Sprintf("r[%d] = %s ", i+1, call)
+	}
+
+	return body + "return " + luaReturns[utils.RandInt(len(luaReturns))]
+}
+
+// private
+// half of the functions are no-writes, write commands fail
+func luaLibrary(body string) string {
+
+	flags := ""
+
+	if utils.RandInt(2) == 0 {
+		flags = ", flags = {'no-writes'}"
+	}
+
+	return fmt.Sprintf(
+		"#!lua name=%s\nredis.register_function{function_name = '%s', callback = function(keys, args) %s end%s}",
+		ScriptLibrary, ScriptFunction, body, flags,
+	)
+}
+
+// private
+// lua 5.1 string, \ddd for other bytes
+func luaQuote(s string) string {
+
+	var b strings.Builder
+
+	b.WriteByte('"')
+
+	for i := 0; i < len(s); i++ {
+
+		c := s[i]
+
+		switch {
+
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+
+		default:
+			fmt.Fprintf(&b, "\\%03d", c)
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
@@ -0,0 +1,280 @@
+package model
+
+import (
+	"slices"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+/*
+ * Sequence Definition
+ */
+
+// sequence mutation
+const (
+	SEQUENCE_MULTI int = iota
+	SEQUENCE_DISCARD
+	SEQUENCE_WATCH
+	SEQUENCE_PIPELINE
+	SEQUENCE_SPREAD
+	SEQUENCE_BLOCK
+	SEQUENCE_MUTATIONS
+)
+
+// connection of a line, main is synchronous
+const (
+	LINE_CLIENT_MAIN int = 0
+	LINE_CLIENT_SIDE int = 1
+	LINE_CLIENTS     int = 4
+)
+
+// template tokens, replaced by snapshot keys
+const (
+	seqKey   string = "{key}"
+	seqOther string = "{other}"
+	// nothing in snapshot
+	seqBlockKey string = "blockkey"
+)
+
+// second connection touches a watched key
+// TOUCH is a read, EXEC still runs
+var sideCmds = [][]string{
+	{"SET", seqKey, "side"},
+	{"DEL", seqKey},
+	{"PEXPIRE", seqKey, "100"},
+	{"TOUCH", seqKey},
+}
+
+// client blocked on key, 0 waits until the command deadline
+var blockCmds = [][]string{
+	{"BLPOP", seqKey, "0"},
+	{"BRPOP", seqKey, "1"},
+	{"BRPOPLPUSH", seqKey, seqOther, "0"},
+	{"BLMOVE", seqKey, seqOther, "LEFT", "RIGHT", "0"},
+	{"BLMPOP", "0", "1", seqKey, "LEFT"},
+	{"BZPOPMIN", seqKey, "0"},
+	{"BZMPOP", "1", "1", seqKey, "MAX"},
+	{"XREAD", "BLOCK", "0", "STREAMS", seqKey, "$"},
+	{"XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", seqKey, ">"},
+	{"SUBSCRIBE", seqKey},
+}
+
+// another client wakes, moves or kills the blocked one
+var wakeCmds = [][]string{
+	{"LPUSH", seqKey, "a"},
+	{"RPUSH", seqKey, "a", "b"},
+	{"LMOVE", seqOther, seqKey, "LEFT", "RIGHT"},
+	{"ZADD", seqKey, "1", "a"},
+	{"XADD", seqKey, "*", "f", "v"},
+	{"XGROUP", "CREATE", seqKey, "g", "$", "MKSTREAM"},
+	{"DEL", seqKey},
+	{"RENAME", seqOther, seqKey},
+	{"RENAME", seqKey, seqOther},
+	{"SET", seqKey, "v"},
+	{"PEXPIRE", seqKey, "0"},
+	{"SWAPDB", "0", "1"},
+	{"FLUSHALL", "ASYNC"},
+	{"PUBLISH", seqKey, "m"},
+	{"CLIENT", "PAUSE", "100", "WRITE"},
+	{"CLIENT", "KILL", "TYPE", "normal", "SKIPME", "yes"},
+}
+
+/*
+ * Sequence Functions
+ */
+
+// public
+// wrap a random span in MULTI/EXEC, MULTI/DISCARD, WATCH or a pipeline,
+// spread it across clients, or block one client on a key
+func MutateSequence(lines []*Line) []*Line {
+
+	if len(lines) == 0 {
+		return lines
+	}
+
+	// span [start, end)
+	start := utils.RandInt(len(lines))
+	end := start + 1 + utils.RandInt(len(lines)-start)
+
+	switch utils.RandInt(SEQUENCE_MUTATIONS) {
+
+	case SEQUENCE_MULTI:
+		return wrapSpan(lines, start, end, "EXEC")
+
+	case SEQUENCE_DISCARD:
+		return wrapSpan(lines, start, end, "DISCARD")
+
+	case SEQUENCE_WATCH:
+		return watchSpan(lines, start, end)
+
+	case SEQUENCE_PIPELINE:
+		pipeSpan(lines, start, end)
+
+	case SEQUENCE_SPREAD:
+		spreadSpan(lines, start, end)
+
+	case SEQUENCE_BLOCK:
+		return blockSpan(lines)
+	}
+
+	return lines
+}
+
+// private
+// MULTI span last
+func wrapSpan(lines []*Line, start, end int, last string) []*Line {
+
+	ret := make([]*Line, 0, len(lines)+2)
+	ret = append(ret, lines[:start]...)
+	ret = append(ret, newSeqLine("MULTI"))
+	ret = append(ret, lines[start:end]...)
+	ret = append(ret, newSeqLine(last))
+
+	return append(ret, lines[end:]...)
+}
+
+// private
+// WATCH key MULTI span EXEC, key from snapshot before span
+// half, second connection touches key before EXEC
+func watchSpan(lines []*Line, start, end int) []*Line {
+
+	keys := make([]string, 0)
+
+	for _, line := range lines[:start] {
+		keys = append(keys, line.Keys()...)
+	}
+
+	// nothing created yet
+	if len(keys) == 0 {
+
+		for _, line := range lines[start:end] {
+			keys = append(keys, line.Keys()...)
+		}
+	}
+
+	if len(keys) == 0 {
+		return wrapSpan(lines, start, end, "EXEC")
+	}
+
+	key := keys[utils.RandInt(len(keys))]
+
+	txn := make([]*Line, 0, end-start+4)
+	txn = append(txn, newSeqLine("WATCH", key), newSeqLine("MULTI"))
+	txn = append(txn, lines[start:end]...)
+	txn = append(txn, newSeqLine("EXEC"))
+
+	if utils.RandInt(2) == 0 {
+
+		side := sideCmds[utils.RandInt(len(sideCmds))]
+
+		line := newSeqLine(fillKeys(side, key, key)...)
+		line.Client = LINE_CLIENT_SIDE
+
+		// after WATCH, before EXEC
+		txn = slices.Insert(txn, 1+utils.RandInt(len(txn)-1), line)
+	}
+
+	ret := make([]*Line, 0, len(lines)+len(txn))
+	ret = append(ret, lines[:start]...)
+	ret = append(ret, txn...)
+
+	return append(ret, lines[end:]...)
+}
+
+// private
+// one pipeline group, ids unique in sequence
+func pipeSpan(lines []*Line, start, end int) {
+
+	pipe := 1
+
+	for _, line := range lines {
+		pipe = max(pipe, line.Pipe+1)
+	}
+
+	for _, line := range lines[start:end] {
+		line.Pipe = pipe
+	}
+}
+
+// private
+// random client per line, pipelines stay on main
+func spreadSpan(lines []*Line, start, end int) {
+
+	for _, line := range lines[start:end] {
+
+		if line.Pipe == 0 {
+			line.Client = utils.RandInt(LINE_CLIENTS)
+		}
+	}
+}
+
+// private
+// one client blocks on a key, others touch it later
+func blockSpan(lines []*Line) []*Line {
+
+	keys := make([]string, 0)
+
+	for _, line := range lines {
+		keys = append(keys, line.Keys()...)
+	}
+
+	if len(keys) == 0 {
+		keys = append(keys, seqBlockKey)
+	}
+
+	key := keys[utils.RandInt(len(keys))]
+	other := keys[utils.RandInt(len(keys))]
+
+	block := newSeqLine(fillKeys(blockCmds[utils.RandInt(len(blockCmds))], key, other)...)
+	block.Client = 1 + utils.RandInt(LINE_CLIENTS-1)
+
+	at := utils.RandInt(len(lines) + 1)
+	ret := slices.Insert(slices.Clone(lines), at, block)
+
+	// one or two wakers after block, never the blocked client
+	for n := utils.RandInt(2) + 1; n > 0; n-- {
+
+		wake := newSeqLine(fillKeys(wakeCmds[utils.RandInt(len(wakeCmds))], key, other)...)
+		wake.Client = (block.Client + 1 + utils.RandInt(LINE_CLIENTS-1)) % LINE_CLIENTS
+
+		ret = slices.Insert(ret, at+1+utils.RandInt(len(ret)-at), wake)
+	}
+
+	return ret
+}
+
+// private
+func fillKeys(template []string, key, other string) []string {
+
+	texts := make([]string, len(template))
+
+	for i, text := range template {
+
+		switch text {
+		case seqKey:
+			texts[i] = key
+		case seqOther:
+			texts[i] = other
+		default:
+			texts[i] = text
+		}
+	}
+
+	return texts
+}
+
+// private
+// cmd line, no graph, AddLines drops it
+func newSeqLine(texts ...string) *Line {
+
+	line := new(Line)
+	line.wrapper = true
+	line.graph = NewGraph()
+	line.tokens = make([]*Token, 0, len(texts))
+
+	for _, text := range texts {
+		line.tokens = append(line.tokens, &Token{Level: TOKEN_LEVEL_0, Text: text})
+	}
+
+	return line
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fuxxcss/redi2fuzz/pkg/utils"
+)
+
+func TestMutateSequence(t *testing.T) {
+
+	for seed := uint64(1); seed <= 64; seed++ {
+
+		utils.SeedMutate(seed)
+
+		lines := []*Line{
+			NewLine("SET k v", "", " "),
+			NewLine("INCR n", "", " "),
+			NewLine("GET k", "", " "),
+		}
+
+		mutated := MutateSequence(slices.Clone(lines))
+
+		// lines keep their order, anything added is a wrapper
+		next := 0
+
+		for _, line := range mutated {
+
+			if next < len(lines) && line == lines[next] {
+				next++
+				continue
+			}
+
+			if !line.wrapper {
+				t.Fatalf("seed %d: %q added, not a wrapper", seed, line.Text())
+			}
+		}
+
+		if next != len(lines) {
+			t.Fatalf("seed %d: %d of %d lines kept", seed, next, len(lines))
+		}
+
+		// wrappers never reach the corpus
+		corpus := NewCorpus("\n", " ")
+		corpus.AddLines(mutated)
+
+		if corpus.Len() != len(lines) {
+			t.Fatalf("seed %d: corpus has %d lines, want %d", seed, corpus.Len(), len(lines))
+		}
+	}
+}
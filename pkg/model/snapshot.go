@@ -5,9 +5,6 @@ import (
 	"slices"
 )
 
-// global
-var oldSnapshot Snapshot
-
 // Snapshot
 type Snapshot map[Token][]Token
 
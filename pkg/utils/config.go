@@ -0,0 +1,376 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * Config Definition
+ */
+
+// --config file, json
+type Config struct {
+	Targets []TargetConfig `json:"targets"`
+}
+
+// one target, unset fields keep the defaults of kind
+type TargetConfig struct {
+	// --target name, built-in name overrides that target
+	Name string `json:"name"`
+	// backend, a built-in target name
+	Kind   string            `json:"kind"`
+	Binary string            `json:"binary"`
+	Port   int               `json:"port"`
+	Args   []string          `json:"args"`
+	Queue  string            `json:"queue"`
+	Env    map[string]string `json:"env"`
+	// --loadmodule each, redi only
+	Modules []string `json:"modules"`
+	// e.g. "30s"
+	Ready string `json:"ready_timeout"`
+	// --profile names, replace the profiles of kind
+	Profiles []Profile `json:"profiles"`
+}
+
+// config names, kind of each
+var targetKinds = map[TargetType]TargetType{}
+var targetLabels = map[TargetType]string{}
+
+/*
+ * Config Functions
+ */
+
+// public
+// validate all targets, then register them
+func LoadConfig(path string) error {
+
+	context, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	var config Config
+
+	decoder := json.NewDecoder(bytes.NewReader(context))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&config)
+
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if len(config.Targets) == 0 {
+		return fmt.Errorf("%s: no targets", path)
+	}
+
+	errs := make([]error, 0)
+	seen := make(map[string]bool)
+
+	for i, tc := range config.Targets {
+
+		for _, err := range tc.validate() {
+			errs = append(errs, fmt.Errorf("%s: targets[%d] %s: %v", path, i, tc.Name, err))
+		}
+
+		name := strings.ToLower(tc.Name)
+
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("%s: targets[%d] %s: name defined twice", path, i, tc.Name))
+		}
+
+		seen[name] = true
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, tc := range config.Targets {
+		tc.register()
+	}
+
+	return nil
+}
+
+// private
+// every problem of one entry
+func (self *TargetConfig) validate() []error {
+
+	errs := make([]error, 0)
+
+	if self.Name == "" {
+		errs = append(errs, errors.New("name is empty"))
+	}
+
+	// --target and --diff lists
+	if strings.ContainsAny(self.Name, ", \t\n") {
+		errs = append(errs, fmt.Errorf("name %q has spaces or commas", self.Name))
+	}
+
+	kind, err := ParseTarget(self.Kind)
+	_, builtin := Targets[kind]
+
+	if err != nil || kind.Kind() != kind || !builtin {
+		errs = append(errs, fmt.Errorf("kind %q is not support", self.Kind))
+	}
+
+	// built-in name keeps its backend
+	named, ok := TargetNames[strings.ToLower(self.Name)]
+
+	if ok && err == nil && named.Kind() != kind {
+		errs = append(errs, fmt.Errorf("name is built-in for %s, kind is %s", named.Kind(), kind))
+	}
+
+	if self.Binary != "" {
+		errs = append(errs, checkFile("binary", self.Binary)...)
+	}
+
+	if self.Port < 0 || self.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d out of range", self.Port))
+	}
+
+	// args are split on spaces
+	for _, arg := range self.Args {
+
+		if arg == "" || strings.ContainsAny(arg, " \t\n") {
+			errs = append(errs, fmt.Errorf("arg %q is empty or has spaces", arg))
+		}
+	}
+
+	if self.Queue != "" {
+
+		info, err := os.Stat(self.Queue)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("queue %v", err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("queue %s is not a dir", self.Queue))
+		}
+	}
+
+	for key, value := range self.Env {
+
+		if key == "" || strings.ContainsAny(key, "=\n") {
+			errs = append(errs, fmt.Errorf("env key %q invalid", key))
+		}
+
+		if strings.Contains(value, "\n") {
+			errs = append(errs, fmt.Errorf("env %s has a newline", key))
+		}
+
+		if key == CoverageEnv || key == AflShmEnv {
+			errs = append(errs, fmt.Errorf("env %s is set by the fuzzer", key))
+		}
+	}
+
+	if len(self.Modules) != 0 && err == nil && kind == KV_ETCD {
+		errs = append(errs, fmt.Errorf("%s has no modules", kind))
+	}
+
+	for _, module := range self.Modules {
+		errs = append(errs, checkFile("module", module)...)
+	}
+
+	if self.Ready != "" {
+
+		ready, err := time.ParseDuration(self.Ready)
+
+		if err != nil || ready <= 0 {
+			errs = append(errs, fmt.Errorf("ready_timeout %q is not a positive duration", self.Ready))
+		}
+	}
+
+	if len(self.Profiles) != 0 && err == nil && kind == KV_ETCD {
+		errs = append(errs, fmt.Errorf("%s has no profiles", kind))
+	}
+
+	names := make(map[string]bool)
+
+	for _, profile := range self.Profiles {
+
+		// one line of TARGET_PROFILES each
+		if profile.Name == "" || profile.Name == ProfileRoundRobin || strings.ContainsAny(profile.Name, ", \t\n") {
+			errs = append(errs, fmt.Errorf("profile name %q invalid", profile.Name))
+		}
+
+		if names[profile.Name] {
+			errs = append(errs, fmt.Errorf("profile %s defined twice", profile.Name))
+		}
+
+		names[profile.Name] = true
+
+		for _, arg := range profile.Args {
+
+			if arg == "" || strings.ContainsAny(arg, " \t\n") {
+				errs = append(errs, fmt.Errorf("profile %s arg %q is empty or has spaces", profile.Name, arg))
+			}
+		}
+
+		err := profile.checkModules()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %v", profile.Name, err))
+		}
+	}
+
+	return errs
+}
+
+// private
+// existing file, no spaces
+func checkFile(what, path string) []error {
+
+	if strings.ContainsAny(path, " \t\n") {
+		return []error{fmt.Errorf("%s %q has spaces", what, path)}
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return []error{fmt.Errorf("%s %v", what, err)}
+	}
+
+	if info.IsDir() {
+		return []error{fmt.Errorf("%s %s is a dir", what, path)}
+	}
+
+	return nil
+}
+
+// private
+// validated entry, override built-in or add a name
+func (self *TargetConfig) register() {
+
+	kind, _ := ParseTarget(self.Kind)
+	feature := maps.Clone(Targets[kind])
+
+	// targets run in their own dirs
+	if self.Binary != "" {
+		feature[TARGET_PATH], _ = filepath.Abs(self.Binary)
+	}
+
+	if self.Port != 0 {
+		feature[TARGET_PORT] = strconv.Itoa(self.Port)
+	}
+
+	if self.Queue != "" {
+		feature[QUEUE_PATH] = self.Queue
+	}
+
+	modules := make([]string, 0, len(self.Modules))
+
+	for _, module := range self.Modules {
+		path, _ := filepath.Abs(module)
+		modules = append(modules, path)
+	}
+
+	args := moduleArgs(self.Args, modules)
+
+	if len(args) != 0 {
+		feature[TARGET_ARGS] = strings.Join(args, " ")
+	}
+
+	env := make([]string, 0, len(self.Env))
+
+	for key, value := range self.Env {
+		env = append(env, key+"="+value)
+	}
+
+	if len(env) != 0 {
+		feature[TARGET_ENV] = strings.Join(env, "\n")
+	}
+
+	if self.Ready != "" {
+		feature[TARGET_READY] = self.Ready
+	}
+
+	profiles := make([]Profile, 0, len(self.Profiles))
+
+	for _, profile := range self.Profiles {
+		profiles = append(profiles, Profile{Name: profile.Name, Args: absModules(profile.Args)})
+	}
+
+	if len(profiles) != 0 {
+		feature[TARGET_PROFILES] = EncodeProfiles(profiles)
+	}
+
+	// built-in name
+	target, ok := TargetNames[strings.ToLower(self.Name)]
+
+	if !ok {
+		target = TARGET_CONFIG + TargetType(len(targetKinds))
+		targetKinds[target] = kind
+		targetLabels[target] = self.Name
+		TargetNames[strings.ToLower(self.Name)] = target
+	}
+
+	Targets[target] = feature
+}
+
+// private
+// path after each --loadmodule, targets run in their own dirs
+func absModules(args []string) []string {
+
+	ret := slices.Clone(args)
+
+	for i := 1; i < len(ret); i++ {
+
+		if ret[i-1] == ProfileModuleArg {
+			ret[i], _ = filepath.Abs(ret[i])
+		}
+	}
+
+	return ret
+}
+
+// private
+// args, then --loadmodule each
+func moduleArgs(args, modules []string) []string {
+
+	all := make([]string, 0, len(args)+2*len(modules))
+	all = append(all, args...)
+
+	for _, module := range modules {
+		all = append(all, ProfileModuleArg, module)
+	}
+
+	return all
+}
+
+// public
+// TARGET_ENV lines
+func (self TargetFeature) Env() []string {
+
+	env, ok := self[TARGET_ENV]
+
+	if !ok || env == "" {
+		return nil
+	}
+
+	return strings.Split(env, "\n")
+}
+
+// public
+// TARGET_READY or def
+func (self TargetFeature) Ready(def time.Duration) time.Duration {
+
+	ready, err := time.ParseDuration(self[TARGET_READY])
+
+	if err != nil || ready <= 0 {
+		return def
+	}
+
+	return ready
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// LoadConfig changes the target tables, put them back after t
+func restoreTargets(t *testing.T) {
+
+	targets := maps.Clone(Targets)
+	names := maps.Clone(TargetNames)
+	kinds := maps.Clone(targetKinds)
+	labels := maps.Clone(targetLabels)
+
+	t.Cleanup(func() {
+		Targets, TargetNames, targetKinds, targetLabels = targets, names, kinds, labels
+	})
+}
+
+func chdir(t *testing.T, dir string) {
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+
+	path := filepath.Join(t.TempDir(), "targets.json")
+
+	if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+
+	restoreTargets(t)
+
+	path := writeConfig(t, `{"targets": [
+		{"name": "Redis-ASAN", "kind": "redis", "binary": "/bin/true", "port": 7100,
+		 "args": ["--protected-mode", "no"], "modules": ["/bin/true"],
+		 "env": {"ASAN_OPTIONS": "detect_leaks=0"}, "ready_timeout": "30s",
+		 "profiles": [{"name": "default"}, {"name": "bloom", "args": ["--loadmodule", "keydb.so", "--appendonly", "yes"]}]},
+		{"name": "keydb", "kind": "keydb", "port": 7200, "modules": ["keydb.so"]}
+	]}`)
+
+	// relative to the fuzzer dir
+	cwd, _ := os.Getwd()
+	chdir(t, filepath.Dir(path))
+	defer chdir(t, cwd)
+
+	if err := os.WriteFile("keydb.so", nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	module, _ := filepath.Abs("keydb.so")
+
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := ParseTarget("redis-asan")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target < TARGET_CONFIG || target.Kind() != REDI_REDIS || target.String() != "Redis-ASAN" {
+		t.Errorf("target %d kind %s name %s", target, target.Kind(), target)
+	}
+
+	feature := Targets[target]
+
+	if feature[TARGET_PATH] != "/bin/true" || feature[TARGET_PORT] != "7100" {
+		t.Errorf("path %s port %s", feature[TARGET_PATH], feature[TARGET_PORT])
+	}
+
+	if want := "--protected-mode no --loadmodule /bin/true"; feature[TARGET_ARGS] != want {
+		t.Errorf("args %q, want %q", feature[TARGET_ARGS], want)
+	}
+
+	if env := feature.Env(); len(env) != 1 || env[0] != "ASAN_OPTIONS=detect_leaks=0" {
+		t.Errorf("env %q", env)
+	}
+
+	if feature.Ready(time.Second) != 30*time.Second {
+		t.Errorf("ready %s", feature.Ready(time.Second))
+	}
+
+	// own profiles, module path is absolute
+	profiles, err := ParseProfiles(feature, ProfileRoundRobin)
+	want := []Profile{{Name: "default", Args: []string{}}, {Name: "bloom", Args: []string{"--loadmodule", module, "--appendonly", "yes"}}}
+
+	if err != nil || !reflect.DeepEqual(profiles, want) {
+		t.Errorf("profiles %v %v, want %v", profiles, err, want)
+	}
+
+	// built-in name keeps its id, unset fields keep defaults
+	if TargetNames["keydb"] != REDI_KEYDB || REDI_KEYDB.Kind() != REDI_KEYDB {
+		t.Errorf("keydb is %d", TargetNames["keydb"])
+	}
+
+	if Targets[REDI_KEYDB][TARGET_ARGS] != "--loadmodule "+module {
+		t.Errorf("keydb args %q", Targets[REDI_KEYDB][TARGET_ARGS])
+	}
+
+	if Targets[REDI_KEYDB][TARGET_PORT] != "7200" || Targets[REDI_KEYDB].Ready(time.Second) != time.Second {
+		t.Errorf("keydb %v", Targets[REDI_KEYDB])
+	}
+
+	// no profiles, those of kind
+	if Targets[REDI_KEYDB][TARGET_PROFILES] != EncodeProfiles(keydbProfiles) {
+		t.Errorf("keydb profiles %v", Targets[REDI_KEYDB].Profiles())
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no targets", `{"targets": []}`},
+		{"unknown field", `{"targets": [{"name": "a", "kind": "redis", "bin": "/bin/true"}]}`},
+		{"empty name", `{"targets": [{"kind": "redis"}]}`},
+		{"comma in name", `{"targets": [{"name": "a,b", "kind": "redis"}]}`},
+		{"unknown kind", `{"targets": [{"name": "a", "kind": "mysql"}]}`},
+		{"config kind", `{"targets": [{"name": "a", "kind": "redis"}, {"name": "b", "kind": "a"}]}`},
+		{"built-in kind", `{"targets": [{"name": "etcd", "kind": "redis"}]}`},
+		{"missing binary", `{"targets": [{"name": "a", "kind": "redis", "binary": "/nonexistent/redis-server"}]}`},
+		{"binary dir", `{"targets": [{"name": "a", "kind": "redis", "binary": "/"}]}`},
+		{"port", `{"targets": [{"name": "a", "kind": "redis", "port": 70000}]}`},
+		{"arg space", `{"targets": [{"name": "a", "kind": "redis", "args": ["--save 60"]}]}`},
+		{"fuzzer env", `{"targets": [{"name": "a", "kind": "redis", "env": {"COVERAGE_MAP": "1"}}]}`},
+		{"etcd modules", `{"targets": [{"name": "a", "kind": "etcd", "modules": ["/bin/true"]}]}`},
+		{"ready", `{"targets": [{"name": "a", "kind": "redis", "ready_timeout": "-1s"}]}`},
+		{"twice", `{"targets": [{"name": "a", "kind": "redis"}, {"name": "A", "kind": "keydb"}]}`},
+		{"profile name", `{"targets": [{"name": "a", "kind": "redis", "profiles": [{"name": "round-robin"}]}]}`},
+		{"profile space", `{"targets": [{"name": "a", "kind": "redis", "profiles": [{"name": "a b"}]}]}`},
+		{"profile twice", `{"targets": [{"name": "a", "kind": "redis", "profiles": [{"name": "p"}, {"name": "p"}]}]}`},
+		{"profile arg", `{"targets": [{"name": "a", "kind": "redis", "profiles": [{"name": "p", "args": ["--io-threads 4"]}]}]}`},
+		{"profile module", `{"targets": [{"name": "a", "kind": "redis", "profiles": [{"name": "p", "args": ["--loadmodule", "/nonexistent.so"]}]}]}`},
+		{"etcd profiles", `{"targets": [{"name": "a", "kind": "etcd", "profiles": [{"name": "p"}]}]}`},
+	}
+
+	for _, tt := range tests {
+
+		t.Run(tt.name, func(t *testing.T) {
+
+			restoreTargets(t)
+
+			names := len(TargetNames)
+
+			if err := LoadConfig(writeConfig(t, tt.content)); err == nil {
+				t.Fatal("no error")
+			}
+
+			// nothing registered
+			if len(TargetNames) != names || len(targetKinds) != 0 {
+				t.Errorf("%d names, %d config targets", len(TargetNames)-names, len(targetKinds))
+			}
+		})
+	}
+}
+
+func TestModuleArgs(t *testing.T) {
+
+	got := moduleArgs([]string{"--port", "1"}, []string{"a.so", "b.so"})
+	want := []string{"--port", "1", "--loadmodule", "a.so", "--loadmodule", "b.so"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
@@ -2,10 +2,48 @@ package utils
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 )
 
 type CrashJson [][]string
 
+// line options, in front of tokens, e.g. ["@pipe=1", "MULTI"]
+// a line of options only is a header, e.g. ["@seed=42", "@profile=aof"]
+const (
+	LineOptClient  string = "@client="
+	LineOptPipe    string = "@pipe="
+	LineOptProfile string = "@profile="
+	LineOptSeed    string = "@seed="
+	LineOptOwner   string = "@owner="
+
+	// corpus of the seed, see Corpus.Mutate
+	LineOptCorpus    string = "@corpus="
+	LineOptSequence  string = "@sequence="
+	LineOptScript    string = "@script="
+	LineOptConfusion string = "@confusion="
+)
+
+type LineOpts struct {
+	// connection, 0 is main
+	Client  int
+	// pipeline group, 0 is none
+	Pipe    int
+	// startup profile, header only
+	Profile string
+	// sequence seed, header only
+	Seed    uint64
+	// cluster node of the sequence tag, header only
+	Owner   int
+
+	// corpus lines and flags of the seed, header only
+	// no corpus is an old header, flags unknown
+	Corpus    int
+	Sequence  bool
+	Script    bool
+	Confusion int
+}
+
 // public
 func (self *CrashJson) ToJson() ([]byte, error) {
 	return json.Marshal(self)
@@ -15,3 +53,178 @@ func (self *CrashJson) ToJson() ([]byte, error) {
 func (self *CrashJson) FromJson(data []byte) error {
 	return json.Unmarshal(data, self)
 }
+
+// public
+// default options are omitted, old crash files stay valid
+func EncodeLine(opts LineOpts, tokens []string) []string {
+
+	line := make([]string, 0, len(tokens)+2)
+
+	if opts.Seed != 0 {
+		line = append(line, LineOptSeed+strconv.FormatUint(opts.Seed, 10))
+	}
+
+	if opts.Client != 0 {
+		line = append(line, LineOptClient+strconv.Itoa(opts.Client))
+	}
+
+	if opts.Pipe != 0 {
+		line = append(line, LineOptPipe+strconv.Itoa(opts.Pipe))
+	}
+
+	if opts.Profile != "" {
+		line = append(line, LineOptProfile+opts.Profile)
+	}
+
+	if opts.Owner != 0 {
+		line = append(line, LineOptOwner+strconv.Itoa(opts.Owner))
+	}
+
+	// flags only make sense with corpus
+	if opts.Corpus != 0 {
+		line = append(line,
+			LineOptCorpus+strconv.Itoa(opts.Corpus),
+			LineOptSequence+strconv.FormatBool(opts.Sequence),
+			LineOptScript+strconv.FormatBool(opts.Script),
+			LineOptConfusion+strconv.Itoa(opts.Confusion),
+		)
+	}
+
+	return append(line, tokens...)
+}
+
+// public
+func DecodeLine(line []string) (LineOpts, []string) {
+
+	var opts LineOpts
+
+	for len(line) > 0 {
+
+		client, ok := strings.CutPrefix(line[0], LineOptClient)
+
+		if ok {
+			opts.Client, _ = strconv.Atoi(client)
+			line = line[1:]
+			continue
+		}
+
+		pipe, ok := strings.CutPrefix(line[0], LineOptPipe)
+
+		if ok {
+			opts.Pipe, _ = strconv.Atoi(pipe)
+			line = line[1:]
+			continue
+		}
+
+		profile, ok := strings.CutPrefix(line[0], LineOptProfile)
+
+		if ok {
+			opts.Profile = profile
+			line = line[1:]
+			continue
+		}
+
+		seed, ok := strings.CutPrefix(line[0], LineOptSeed)
+
+		if ok {
+			opts.Seed, _ = strconv.ParseUint(seed, 10, 64)
+			line = line[1:]
+			continue
+		}
+
+		owner, ok := strings.CutPrefix(line[0], LineOptOwner)
+
+		if ok {
+			opts.Owner, _ = strconv.Atoi(owner)
+			line = line[1:]
+			continue
+		}
+
+		corpus, ok := strings.CutPrefix(line[0], LineOptCorpus)
+
+		if ok {
+			opts.Corpus, _ = strconv.Atoi(corpus)
+			line = line[1:]
+			continue
+		}
+
+		sequence, ok := strings.CutPrefix(line[0], LineOptSequence)
+
+		if ok {
+			opts.Sequence, _ = strconv.ParseBool(sequence)
+			line = line[1:]
+			continue
+		}
+
+		script, ok := strings.CutPrefix(line[0], LineOptScript)
+
+		if ok {
+			opts.Script, _ = strconv.ParseBool(script)
+			line = line[1:]
+			continue
+		}
+
+		confusion, ok := strings.CutPrefix(line[0], LineOptConfusion)
+
+		if ok {
+			opts.Confusion, _ = strconv.Atoi(confusion)
+			line = line[1:]
+			continue
+		}
+
+		break
+	}
+
+	return opts, line
+}
+
+// public
+// options of the header line, false if none
+func CrashHeader(cj CrashJson) (LineOpts, bool) {
+
+	if len(cj) == 0 {
+		return LineOpts{}, false
+	}
+
+	opts, tokens := DecodeLine(cj[0])
+
+	if len(tokens) != 0 || len(cj[0]) == 0 {
+		return LineOpts{}, false
+	}
+
+	return opts, true
+}
+
+// public
+// profile of the header line, "" if none
+func CrashProfile(cj CrashJson) string {
+
+	opts, _ := CrashHeader(cj)
+
+	return opts.Profile
+}
+
+// public
+// end of the pipeline starting at index, index+1 if not piped
+func LineGroup(cj CrashJson, index int) int {
+
+	opts, _ := DecodeLine(cj[index])
+	end := index + 1
+
+	if opts.Pipe == 0 {
+		return end
+	}
+
+	for end < len(cj) {
+
+		next, _ := DecodeLine(cj[end])
+
+		if next.Pipe != opts.Pipe {
+			break
+		}
+
+		end++
+	}
+
+	return end
+}
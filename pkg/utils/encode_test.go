@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeLine(t *testing.T) {
+
+	tests := []struct {
+		opts LineOpts
+		want []string
+	}{
+		// defaults are omitted
+		{LineOpts{}, []string{"GET", "k"}},
+		{LineOpts{Client: 2}, []string{"@client=2", "GET", "k"}},
+		{LineOpts{Client: 1, Pipe: 3}, []string{"@client=1", "@pipe=3", "GET", "k"}},
+	}
+
+	for _, tt := range tests {
+
+		line := EncodeLine(tt.opts, []string{"GET", "k"})
+
+		if !reflect.DeepEqual(line, tt.want) {
+			t.Errorf("EncodeLine(%+v): %q, want %q", tt.opts, line, tt.want)
+		}
+
+		opts, tokens := DecodeLine(line)
+
+		if opts != tt.opts || !reflect.DeepEqual(tokens, []string{"GET", "k"}) {
+			t.Errorf("DecodeLine(%q): %+v %q", line, opts, tokens)
+		}
+	}
+}
+
+func TestDecodeLine(t *testing.T) {
+
+	// options only in front
+	opts, tokens := DecodeLine([]string{"@pipe=1", "SET", "@client=2", "v"})
+
+	if opts != (LineOpts{Pipe: 1}) || !reflect.DeepEqual(tokens, []string{"SET", "@client=2", "v"}) {
+		t.Errorf("%+v %q", opts, tokens)
+	}
+
+	// old crash files have no options
+	opts, tokens = DecodeLine([]string{"PING"})
+
+	if opts != (LineOpts{}) || !reflect.DeepEqual(tokens, []string{"PING"}) {
+		t.Errorf("%+v %q", opts, tokens)
+	}
+}
+
+func TestLineGroup(t *testing.T) {
+
+	cj := CrashJson{
+		{"SET", "k", "v"},
+		{"@pipe=1", "MULTI"},
+		{"@pipe=1", "INCR", "k"},
+		{"@pipe=1", "EXEC"},
+		{"@pipe=2", "GET", "k"},
+		{"@client=1", "GET", "k"},
+	}
+
+	tests := []struct {
+		index int
+		want  int
+	}{
+		{0, 1},
+		{1, 4},
+		{4, 5},
+		{5, 6},
+	}
+
+	for _, tt := range tests {
+
+		if got := LineGroup(cj, tt.index); got != tt.want {
+			t.Errorf("LineGroup(%d): %d, want %d", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeHeader(t *testing.T) {
+
+	opts := LineOpts{Seed: 9, Corpus: 120, Sequence: true, Confusion: 0}
+	header := EncodeLine(opts, nil)
+
+	want := []string{"@seed=9", "@corpus=120", "@sequence=true", "@script=false", "@confusion=0"}
+
+	if !reflect.DeepEqual(header, want) {
+		t.Errorf("%q, want %q", header, want)
+	}
+
+	if got, _ := DecodeLine(header); got != opts {
+		t.Errorf("%+v, want %+v", got, opts)
+	}
+
+	// old header, no flags
+	header = EncodeLine(LineOpts{Seed: 9, Confusion: 10}, nil)
+
+	if !reflect.DeepEqual(header, []string{"@seed=9"}) {
+		t.Errorf("%q", header)
+	}
+}
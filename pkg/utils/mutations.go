@@ -45,5 +45,39 @@ var InterestingValue = []string {
 	"0.0000000000000001",
 }
 
+// interesting integers
+var InterestingInteger = []string {
+	"-1",
+	"0",
+	"1",
+	"-2147483648",
+	"2147483647",
+	"4294967296",
+	"9223372036854775807",
+	"-9223372036854775808",
+	"18446744073709551616",
+}
 
+// interesting doubles
+var InterestingDouble = []string {
+	"-0.0",
+	"0.5",
+	"1e308",
+	"-1e308",
+	"4.9e-324",
+	"inf",
+	"-inf",
+	"+inf",
+	"nan",
+}
 
+// interesting patterns
+var InterestingPattern = []string {
+	"*",
+	"?",
+	"[a-z]*",
+	"[^",
+	"\\",
+	"*[",
+	"**********************",
+}
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// startup args under a name, loadmodule args too, e.g. "--loadmodule", "/path/redisbloom.so"
+type Profile struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// every profile in turn
+const (
+	ProfileRoundRobin string = "round-robin"
+	ProfileDefault    string = "default"
+)
+
+// redis family
+var rediProfiles = []Profile{
+	{Name: ProfileDefault},
+	{Name: "aof", Args: []string{"--appendonly", "yes", "--appendfsync", "always"}},
+	{Name: "io-threads", Args: []string{"--io-threads", "4", "--io-threads-do-reads", "yes"}},
+	{Name: "maxmemory", Args: []string{"--maxmemory", "64mb", "--maxmemory-policy", "allkeys-lfu"}},
+	{Name: "lazyfree", Args: []string{
+		"--lazyfree-lazy-eviction", "yes",
+		"--lazyfree-lazy-expire", "yes",
+		"--lazyfree-lazy-server-del", "yes",
+		"--lazyfree-lazy-user-del", "yes",
+		"--lazyfree-lazy-user-flush", "yes",
+	}},
+	{Name: "debug", Args: []string{"--enable-debug-command", "yes"}},
+	{Name: "listpack", Args: []string{
+		"--hash-max-listpack-entries", "1",
+		"--set-max-intset-entries", "1",
+		"--zset-max-listpack-entries", "1",
+		"--list-max-listpack-size", "1",
+	}},
+}
+
+// keydb 6, no debug switch, ziplist names
+var keydbProfiles = []Profile{
+	{Name: ProfileDefault},
+	{Name: "aof", Args: []string{"--appendonly", "yes", "--appendfsync", "always"}},
+	{Name: "server-threads", Args: []string{"--server-threads", "4"}},
+	{Name: "maxmemory", Args: []string{"--maxmemory", "64mb", "--maxmemory-policy", "allkeys-lfu"}},
+	{Name: "lazyfree", Args: []string{
+		"--lazyfree-lazy-eviction", "yes",
+		"--lazyfree-lazy-expire", "yes",
+		"--lazyfree-lazy-server-del", "yes",
+	}},
+	{Name: "ziplist", Args: []string{
+		"--hash-max-ziplist-entries", "1",
+		"--set-max-intset-entries", "1",
+		"--zset-max-ziplist-entries", "1",
+		"--list-max-ziplist-size", "1",
+	}},
+}
+
+// module args, checked by ParseProfiles
+const (
+	ProfileModuleArg string = "--loadmodule"
+)
+
+// public
+// TARGET_PROFILES of a target definition, one profile per line, name then args
+func EncodeProfiles(profiles []Profile) string {
+
+	lines := make([]string, 0, len(profiles))
+
+	for _, profile := range profiles {
+		lines = append(lines, strings.Join(append([]string{profile.Name}, profile.Args...), " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// public
+// TARGET_PROFILES lines
+func (self TargetFeature) Profiles() []Profile {
+
+	profiles := make([]Profile, 0)
+
+	for _, line := range strings.Split(self[TARGET_PROFILES], "\n") {
+
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		profiles = append(profiles, Profile{Name: fields[0], Args: fields[1:]})
+	}
+
+	return profiles
+}
+
+// public
+// nil if name is empty, all profiles if round-robin
+func ParseProfiles(feature TargetFeature, name string) ([]Profile, error) {
+
+	if name == "" {
+		return nil, nil
+	}
+
+	profiles := feature.Profiles()
+
+	if len(profiles) == 0 {
+		return nil, errors.New("target has no profiles")
+	}
+
+	// e.g. redisbloom.so of another host
+	for _, profile := range profiles {
+
+		if name != ProfileRoundRobin && profile.Name != name {
+			continue
+		}
+
+		err := profile.checkModules()
+
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+	}
+
+	if name == ProfileRoundRobin {
+		return profiles, nil
+	}
+
+	for _, profile := range profiles {
+
+		if profile.Name == name {
+			return []Profile{profile}, nil
+		}
+	}
+
+	names := make([]string, 0, len(profiles))
+
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+
+	return nil, fmt.Errorf("profile %s is not support (%s, %s)", name, strings.Join(names, ", "), ProfileRoundRobin)
+}
+
+// private
+// file after each --loadmodule
+func (self Profile) checkModules() error {
+
+	for i, arg := range self.Args {
+
+		if arg != ProfileModuleArg {
+			continue
+		}
+
+		if i+1 == len(self.Args) {
+			return fmt.Errorf("%s without path", ProfileModuleArg)
+		}
+
+		errs := checkFile("module", self.Args[i+1])
+
+		if len(errs) != 0 {
+			return errs[0]
+		}
+	}
+
+	return nil
+}
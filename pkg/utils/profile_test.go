@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseProfiles(t *testing.T) {
+
+	// no --profile
+	profiles, err := ParseProfiles(Targets[REDI_REDIS], "")
+
+	if err != nil || profiles != nil {
+		t.Errorf("empty: %v %v", profiles, err)
+	}
+
+	profiles, err = ParseProfiles(Targets[REDI_REDIS], "aof")
+
+	if err != nil || !reflect.DeepEqual(profiles, []Profile{rediProfiles[1]}) {
+		t.Errorf("aof: %v %v", profiles, err)
+	}
+
+	profiles, err = ParseProfiles(Targets[REDI_KEYDB], ProfileRoundRobin)
+
+	if err != nil || len(profiles) != len(keydbProfiles) {
+		t.Errorf("round-robin: %d profiles %v", len(profiles), err)
+	}
+
+	// keydb has no io-threads
+	if _, err := ParseProfiles(Targets[REDI_KEYDB], "io-threads"); err == nil {
+		t.Error("keydb io-threads accepted")
+	}
+
+	if _, err := ParseProfiles(Targets[KV_ETCD], ProfileDefault); err == nil {
+		t.Error("etcd profile accepted")
+	}
+}
+
+func TestProfilesModules(t *testing.T) {
+
+	module := filepath.Join(t.TempDir(), "redisbloom.so")
+
+	if err := os.WriteFile(module, nil, 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	feature := TargetFeature{TARGET_PROFILES: EncodeProfiles([]Profile{
+		{Name: ProfileDefault},
+		{Name: "bloom", Args: []string{ProfileModuleArg, module}},
+		{Name: "missing", Args: []string{ProfileModuleArg, module + ".gone"}},
+	})}
+
+	profiles, err := ParseProfiles(feature, "bloom")
+
+	if err != nil || len(profiles) != 1 || !reflect.DeepEqual(profiles[0].Args, []string{ProfileModuleArg, module}) {
+		t.Errorf("bloom: %v %v", profiles, err)
+	}
+
+	// only the chosen profile is checked
+	if _, err := ParseProfiles(feature, ProfileDefault); err != nil {
+		t.Errorf("default: %v", err)
+	}
+
+	for _, name := range []string{"missing", ProfileRoundRobin} {
+
+		if _, err := ParseProfiles(feature, name); err == nil {
+			t.Errorf("%s: missing module accepted", name)
+		}
+	}
+}
+
+func TestCrashHeader(t *testing.T) {
+
+	tests := []struct {
+		cj     CrashJson
+		opts   LineOpts
+		header bool
+	}{
+		{CrashJson{{"@seed=42", "@profile=aof", "@owner=2"}, {"PING"}}, LineOpts{Seed: 42, Profile: "aof", Owner: 2}, true},
+		// old crash files start with a command
+		{CrashJson{{"PING"}}, LineOpts{}, false},
+		// options of a line are not a header
+		{CrashJson{{"@client=1", "PING"}}, LineOpts{}, false},
+		{CrashJson{{}}, LineOpts{}, false},
+		{CrashJson{}, LineOpts{}, false},
+	}
+
+	for _, tt := range tests {
+
+		opts, ok := CrashHeader(tt.cj)
+
+		if opts != tt.opts || ok != tt.header {
+			t.Errorf("CrashHeader(%q): %+v %v, want %+v %v", tt.cj, opts, ok, tt.opts, tt.header)
+		}
+
+		if CrashProfile(tt.cj) != tt.opts.Profile {
+			t.Errorf("CrashProfile(%q): %q", tt.cj, CrashProfile(tt.cj))
+		}
+	}
+
+	// header round trip
+	opts := LineOpts{Seed: 7, Profile: "listpack", Owner: 1}
+	got, ok := CrashHeader(CrashJson{EncodeLine(opts, nil)})
+
+	if !ok || got != opts {
+		t.Errorf("%+v %v, want %+v", got, ok, opts)
+	}
+}
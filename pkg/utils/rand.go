@@ -1,24 +1,132 @@
 package utils
 
 import (
-	"encoding/binary"
-	"crypto/rand"
-	"math/big"
+	"math/rand/v2"
+	"sync"
+	"time"
 )
 
-func RandFloat() float64 {
+/*
+ * Rand Definition
+ */
+
+// pluggable generator, e.g. rand.PCG or rand.ChaCha8
+type RandSource interface {
+	Uint64() uint64
+}
+
+// seeded generator, safe for goroutines
+type Rand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// second pcg word, fixed so one seed is one stream
+const (
+	RandStream uint64 = 0x72326621
+)
+
+// mutation decisions, seeded per sequence by the corpus
+var mutateRand = NewRand(uint64(time.Now().UnixNano()))
+
+// per-sequence seeds, seeded by --seed
+var seedRand = NewRand(uint64(time.Now().UnixNano()))
 
-	buf := make([]byte, 8)
-	rand.Read(buf)
-	bits := binary.BigEndian.Uint32(buf)
+/*
+ * Rand Functions
+ */
 
-	return float64(bits) / float64(1<<64)
+// public
+func NewRand(seed uint64) *Rand {
 
+	return NewRandSource(rand.NewPCG(seed, RandStream))
 }
 
-func RandInt(ts int) int {
+// public
+func NewRandSource(src RandSource) *Rand {
+
+	return &Rand{rand: rand.New(src)}
+}
+
+// public
+// restart stream
+func (self *Rand) Seed(seed uint64) {
+
+	self.SetSource(rand.NewPCG(seed, RandStream))
+}
+
+// public
+func (self *Rand) SetSource(src RandSource) {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.rand = rand.New(src)
+}
+
+// public
+// [0, n)
+func (self *Rand) Int(n int) int {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.rand.IntN(n)
+}
+
+// public
+// [0, 1)
+func (self *Rand) Float() float64 {
 
-	n, _ := rand.Int(rand.Reader, big.NewInt(int64(ts)))
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.rand.Float64()
+}
+
+// public
+func (self *Rand) Uint64() uint64 {
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.rand.Uint64()
+}
+
+// public
+// --seed, same seed gives the same sequence seeds
+func SetSeed(seed uint64) {
+
+	seedRand.Seed(seed)
+}
+
+// public
+// seed of the next sequence
+func NextSeed() uint64 {
+
+	return seedRand.Uint64()
+}
+
+// public
+// mutations after this are a function of seed and corpus
+func SeedMutate(seed uint64) {
+
+	mutateRand.Seed(seed)
+}
+
+// public
+// generator behind RandInt and RandFloat
+func SetRandSource(src RandSource) {
+
+	mutateRand.SetSource(src)
+}
+
+func RandFloat() float64 {
+
+	return mutateRand.Float()
+}
+
+func RandInt(ts int) int {
 
-	return int(n.Int64())
+	return mutateRand.Int(ts)
 }
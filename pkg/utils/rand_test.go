@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestRandSeed(t *testing.T) {
+
+	a, b := NewRand(42), NewRand(42)
+
+	for i := 0; i < 100; i++ {
+
+		if a.Uint64() != b.Uint64() || a.Int(1000) != b.Int(1000) || a.Float() != b.Float() {
+			t.Fatalf("same seed differs at %d", i)
+		}
+	}
+
+	// Seed restarts the stream
+	first := NewRand(7).Uint64()
+	a.Seed(7)
+
+	if got := a.Uint64(); got != first {
+		t.Errorf("reseeded %d, want %d", got, first)
+	}
+
+	if NewRand(1).Uint64() == NewRand(2).Uint64() {
+		t.Error("seeds 1 and 2 give the same value")
+	}
+}
+
+func TestRandRange(t *testing.T) {
+
+	rng := NewRand(3)
+
+	for i := 0; i < 1000; i++ {
+
+		if n := rng.Int(5); n < 0 || n >= 5 {
+			t.Fatalf("Int(5) = %d", n)
+		}
+
+		if f := rng.Float(); f < 0 || f >= 1 {
+			t.Fatalf("Float() = %f", f)
+		}
+	}
+}
+
+func TestSeedMutate(t *testing.T) {
+
+	draw := func() []int {
+
+		ret := make([]int, 0, 10)
+
+		for i := 0; i < 10; i++ {
+			ret = append(ret, RandInt(100))
+		}
+
+		return ret
+	}
+
+	SeedMutate(99)
+	first := draw()
+
+	SeedMutate(99)
+	second := draw()
+
+	for i := range first {
+
+		if first[i] != second[i] {
+			t.Fatalf("%v, want %v", second, first)
+		}
+	}
+
+	// --seed gives the same sequence seeds
+	SetSeed(5)
+	a := []uint64{NextSeed(), NextSeed()}
+
+	SetSeed(5)
+	b := []uint64{NextSeed(), NextSeed()}
+
+	if a[0] != b[0] || a[1] != b[1] {
+		t.Errorf("%v, want %v", b, a)
+	}
+}
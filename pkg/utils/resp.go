@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// resp framing mutation
+const (
+	RespValid int = iota
+	RespInline
+	RespBadCount
+	RespNegativeBulk
+	RespOversizedBulk
+	RespMissingCRLF
+	RespSplit
+	RespHavoc
+	RESP_MUTATIONS
+)
+
+// raw line in crash json, RAW base64(packet)...
+const (
+	RawTag string = "RAW"
+)
+
+// interesting lengths
+var InterestingLen = []string{
+	"-1",
+	"-2",
+	"0",
+	"2147483647",
+	"2147483648",
+	"4294967296",
+	"9223372036854775807",
+	"-9223372036854775808",
+	"1048577",
+	"536870913",
+}
+
+// interesting bytes
+var InterestingByte = []byte{
+	0x00, '\r', '\n', '*', '$', '+', '-', ':', ' ', '"', '\'', '\\', 0x7f, 0xff,
+}
+
+// public
+func EncodeRESP(tokens []string) []byte {
+
+	var buf strings.Builder
+
+	buf.WriteString("*" + strconv.Itoa(len(tokens)) + "\r\n")
+
+	for _, token := range tokens {
+		buf.WriteString("$" + strconv.Itoa(len(token)) + "\r\n")
+		buf.WriteString(token + "\r\n")
+	}
+
+	return []byte(buf.String())
+}
+
+// public
+// frame tokens with one protocol mutation, return packets, rng of the worker
+func MutateRESP(rng *Rand, tokens []string) [][]byte {
+
+	// empty line
+	if len(tokens) == 0 {
+		return [][]byte{[]byte("\r\n")}
+	}
+
+	switch rng.Int(RESP_MUTATIONS) {
+
+	// ping\r\n
+	case RespInline:
+		return [][]byte{[]byte(strings.Join(tokens, " ") + "\r\n")}
+
+	// *<bad>\r\n
+	case RespBadCount:
+		data := EncodeRESP(tokens)
+		end := strings.Index(string(data), "\r\n")
+		count := InterestingLen[rng.Int(len(InterestingLen))]
+
+		// count off by one
+		if rng.Int(2) == 0 {
+			count = strconv.Itoa(len(tokens) + rng.Int(3) - 1)
+		}
+
+		return [][]byte{append([]byte("*"+count), data[end:]...)}
+
+	// $-n\r\n
+	case RespNegativeBulk:
+		return [][]byte{encodeBulkLen(rng, tokens, "-"+strconv.Itoa(rng.Int(10)+2))}
+
+	// $<huge>\r\n
+	case RespOversizedBulk:
+		return [][]byte{encodeBulkLen(rng, tokens, InterestingLen[rng.Int(len(InterestingLen))])}
+
+	// drop or damage one crlf
+	case RespMissingCRLF:
+		data := string(EncodeRESP(tokens))
+		n := strings.Count(data, "\r\n")
+		nth := rng.Int(n)
+		replace := []string{"", "\n", "\r", "\n\r"}[rng.Int(4)]
+
+		return [][]byte{[]byte(replaceNth(data, "\r\n", replace, nth))}
+
+	// valid bytes, random packets
+	case RespSplit:
+		return SplitPackets(rng, EncodeRESP(tokens))
+
+	// byte level
+	case RespHavoc:
+		return [][]byte{MutateBytes(rng, EncodeRESP(tokens))}
+	}
+
+	return [][]byte{EncodeRESP(tokens)}
+}
+
+// public
+func SplitPackets(rng *Rand, data []byte) [][]byte {
+
+	packets := make([][]byte, 0)
+
+	for len(data) > 1 {
+
+		n := rng.Int(len(data)-1) + 1
+		packets = append(packets, data[:n])
+		data = data[n:]
+	}
+
+	if len(data) > 0 {
+		packets = append(packets, data)
+	}
+
+	return packets
+}
+
+// public
+// afl havoc like: flip, interesting byte, insert, delete
+func MutateBytes(rng *Rand, data []byte) []byte {
+
+	ret := append([]byte{}, data...)
+	rounds := rng.Int(8) + 1
+
+	for i := 0; i < rounds && len(ret) > 0; i++ {
+
+		pos := rng.Int(len(ret))
+
+		switch rng.Int(4) {
+
+		// flip bit
+		case 0:
+			ret[pos] ^= 1 << rng.Int(8)
+
+		// interesting byte
+		case 1:
+			ret[pos] = InterestingByte[rng.Int(len(InterestingByte))]
+
+		// insert
+		case 2:
+			b := InterestingByte[rng.Int(len(InterestingByte))]
+			ret = append(ret[:pos], append([]byte{b}, ret[pos:]...)...)
+
+		// delete
+		case 3:
+			ret = append(ret[:pos], ret[pos+1:]...)
+		}
+	}
+
+	return ret
+}
+
+// public
+func EncodeRawLine(packets [][]byte) []string {
+
+	line := []string{RawTag}
+
+	for _, packet := range packets {
+		line = append(line, base64.StdEncoding.EncodeToString(packet))
+	}
+
+	return line
+}
+
+// public
+func DecodeRawLine(line []string) ([][]byte, bool) {
+
+	if len(line) == 0 || line[0] != RawTag {
+		return nil, false
+	}
+
+	packets := make([][]byte, 0, len(line)-1)
+
+	for _, text := range line[1:] {
+
+		packet, err := base64.StdEncoding.DecodeString(text)
+
+		if err != nil {
+			return nil, false
+		}
+
+		packets = append(packets, packet)
+	}
+
+	return packets, true
+}
+
+// private
+// one bulk with bad length
+func encodeBulkLen(rng *Rand, tokens []string, length string) []byte {
+
+	var buf strings.Builder
+
+	bad := rng.Int(len(tokens))
+	buf.WriteString("*" + strconv.Itoa(len(tokens)) + "\r\n")
+
+	for i, token := range tokens {
+
+		if i == bad {
+			buf.WriteString("$" + length + "\r\n")
+		} else {
+			buf.WriteString("$" + strconv.Itoa(len(token)) + "\r\n")
+		}
+
+		buf.WriteString(token + "\r\n")
+	}
+
+	return []byte(buf.String())
+}
+
+// private
+func replaceNth(s, old, new string, nth int) string {
+
+	index := 0
+
+	for i := 0; i <= nth; i++ {
+
+		next := strings.Index(s[index:], old)
+
+		if next < 0 {
+			return s
+		}
+
+		if i == nth {
+			index += next
+			break
+		}
+
+		index += next + len(old)
+	}
+
+	return s[:index] + new + s[index+len(old):]
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeRESP(t *testing.T) {
+
+	got := string(EncodeRESP([]string{"SET", "k", ""}))
+	want := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$0\r\n\r\n"
+
+	if got != want {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
+
+func TestReplaceNth(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		nth  int
+		want string
+	}{
+		{"a\r\nb\r\nc\r\n", 0, "a\nb\r\nc\r\n"},
+		{"a\r\nb\r\nc\r\n", 2, "a\r\nb\r\nc\n"},
+		// out of range, unchanged
+		{"a\r\nb", 3, "a\r\nb"},
+	}
+
+	for _, tt := range tests {
+
+		got := replaceNth(tt.s, "\r\n", "\n", tt.nth)
+
+		if got != tt.want {
+			t.Errorf("replaceNth(%q, %d): %q, want %q", tt.s, tt.nth, got, tt.want)
+		}
+	}
+}
+
+func TestRawLine(t *testing.T) {
+
+	packets := [][]byte{[]byte("*1\r\n$4\r\nPING"), {0x00, 0xff, '\r'}}
+	line := EncodeRawLine(packets)
+
+	if line[0] != RawTag {
+		t.Fatalf("tag %s", line[0])
+	}
+
+	got, ok := DecodeRawLine(line)
+
+	if !ok || !reflect.DeepEqual(got, packets) {
+		t.Errorf("%v %v, want %v", got, ok, packets)
+	}
+
+	// plain lines are not raw
+	if _, ok := DecodeRawLine([]string{"SET", "k", "v"}); ok {
+		t.Error("plain line decoded as raw")
+	}
+
+	if _, ok := DecodeRawLine([]string{RawTag, "!!"}); ok {
+		t.Error("bad base64 decoded")
+	}
+}
+
+func TestMutateRESP(t *testing.T) {
+
+	tokens := []string{"SET", "key", "value"}
+	valid := EncodeRESP(tokens)
+
+	for seed := uint64(0); seed < 500; seed++ {
+
+		packets := MutateRESP(NewRand(seed), tokens)
+
+		if len(packets) == 0 {
+			t.Fatalf("seed %d: no packets", seed)
+		}
+
+		// same seed, same framing
+		again := MutateRESP(NewRand(seed), tokens)
+
+		if !reflect.DeepEqual(packets, again) {
+			t.Fatalf("seed %d: %q then %q", seed, packets, again)
+		}
+
+		// split keeps bytes
+		joined := bytes.Join(packets, nil)
+
+		if len(packets) > 1 && !bytes.Equal(joined, valid) {
+			t.Errorf("seed %d: split %q, want %q", seed, joined, valid)
+		}
+	}
+
+	got := MutateRESP(NewRand(0), nil)
+
+	if !reflect.DeepEqual(got, [][]byte{[]byte("\r\n")}) {
+		t.Errorf("empty line: %q", got)
+	}
+}
@@ -1,11 +1,18 @@
 package utils
 
+import (
+	"fmt"
+	"strings"
+)
+
 // traget state
 type TargetState int
 const (
 	STATE_OK  TargetState = iota
 	STATE_ERR
 	STATE_CRASH
+	// running, but no PING reply
+	STATE_HANG
 )
 
 // fuzz targets
@@ -15,8 +22,14 @@ const (
 	REDI_REDIS TargetType = iota
 	REDI_KEYDB 
 	REDI_STACK
+	REDI_VALKEY
+	REDI_CLUSTER
+	// KV
+	KV_ETCD
 	// TS
 	TS_IOTDB
+	// first name from --config, see LoadConfig
+	TARGET_CONFIG
 )
 
 // target feature type
@@ -26,32 +39,157 @@ const (
 	TARGET_PORT TargetFeatureType = iota
 	TARGET_PATH
 	QUEUE_PATH
+	// runtime
+	COVERAGE_ID
+	TARGET_NAME
+	// extra startup args, split on spaces, e.g. "--enable-debug-command local"
+	TARGET_ARGS
+	// args of startup profile, see ParseProfiles
+	TARGET_PROFILE
+	// startup profiles of the target, see EncodeProfiles
+	TARGET_PROFILES
+	// KEY=VALUE per line, e.g. ASAN_OPTIONS
+	TARGET_ENV
+	// readiness timeout, e.g. "30s"
+	TARGET_READY
+	// runtime, backend name of TARGET_NAME
+	TARGET_KIND
 )
 
 type TargetFeature map[TargetFeatureType]string
 
+// afl coverage env
+const (
+	CoverageEnv string = "COVERAGE_MAP"
+	AflShmEnv   string = "__AFL_SHM_ID"
+)
+
 var Targets = map[TargetType]TargetFeature {
 	// Redis
 	REDI_REDIS : {
 		TARGET_PORT : "6379",
 		TARGET_PATH : "/usr/local/redis/src/redis-server",
 		QUEUE_PATH : "queue/redis",
+		TARGET_PROFILES : EncodeProfiles(rediProfiles),
 	},
 	// KeyDB
 	REDI_KEYDB : {
 		TARGET_PORT : "6380",
 		TARGET_PATH : "/usr/local/keydb/src/keydb-server",
 		QUEUE_PATH : "queue/redis",
+		TARGET_PROFILES : EncodeProfiles(keydbProfiles),
 	},
 	// RediStack
 	REDI_STACK : {
 		TARGET_PORT : "6381",
 		TARGET_PATH : "/usr/local/redis/src/redis-stack-server",
 		QUEUE_PATH : "queue/redis-stack",
+		TARGET_PROFILES : EncodeProfiles(rediProfiles),
+	},
+	// Valkey
+	REDI_VALKEY : {
+		TARGET_PORT : "6382",
+		TARGET_PATH : "/usr/local/valkey/src/valkey-server",
+		QUEUE_PATH : "queue/redis",
+		TARGET_PROFILES : EncodeProfiles(rediProfiles),
+	},
+	// Redis Cluster, 3 masters from port
+	REDI_CLUSTER : {
+		TARGET_PORT : "7000",
+		TARGET_PATH : "/usr/local/redis/src/redis-server",
+		QUEUE_PATH : "queue/cluster",
+		TARGET_PROFILES : EncodeProfiles(rediProfiles),
+	},
+	// Etcd
+	KV_ETCD : {
+		TARGET_PORT : "2379",
+		TARGET_PATH : "/usr/local/etcd/bin/etcd",
+		QUEUE_PATH : "queue/etcd",
 	},
 }
 
+// target names
+var TargetNames = map[string]TargetType {
+	"redis" : REDI_REDIS,
+	"keydb" : REDI_KEYDB,
+	"redis-stack" : REDI_STACK,
+	"redis stack" : REDI_STACK,
+	"valkey" : REDI_VALKEY,
+	"redis-cluster" : REDI_CLUSTER,
+	"cluster" : REDI_CLUSTER,
+	"etcd" : KV_ETCD,
+}
+
+// public
+// backend of a --config name, built-in targets are their own kind
+func (self TargetType) Kind() TargetType {
+
+	kind, ok := targetKinds[self]
+
+	if ok {
+		return kind
+	}
+
+	return self
+}
 
+// public
+func (self TargetType) String() string {
 
+	label, ok := targetLabels[self]
 
+	if ok {
+		return label
+	}
 
+	switch self {
+	case REDI_REDIS:
+		return "redis"
+	case REDI_KEYDB:
+		return "keydb"
+	case REDI_STACK:
+		return "redis-stack"
+	case REDI_VALKEY:
+		return "valkey"
+	case REDI_CLUSTER:
+		return "redis-cluster"
+	case KV_ETCD:
+		return "etcd"
+	case TS_IOTDB:
+		return "iotdb"
+	}
+
+	return fmt.Sprintf("target(%d)", int(self))
+}
+
+// public
+func ParseTarget(name string) (TargetType, error) {
+
+	target, ok := TargetNames[strings.ToLower(strings.TrimSpace(name))]
+
+	if !ok {
+		return 0, fmt.Errorf("%s is not support", name)
+	}
+
+	return target, nil
+}
+
+// public
+// redis,keydb,...
+func ParseTargets(names string) ([]TargetType, error) {
+
+	targets := make([]TargetType, 0)
+
+	for _, name := range strings.Split(names, ",") {
+
+		target, err := ParseTarget(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}